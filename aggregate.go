@@ -0,0 +1,273 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// hasKey returns true if key is a row name in the head of the collection.
+func (c *Collection) hasKey(key string) bool {
+	for _, h := range c.Head {
+		if h == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Values returns the non-empty entries with the given row name of all columns.
+// An error of type ColKeyError is returned if key is not in the head.
+func (c *Collection) Values(key string) ([]string, error) {
+	if !c.hasKey(key) {
+		return nil, NewColKeyError("invalid key: %s, allowed keys are %s", key, strings.Join(c.Head, ", "))
+	}
+	res := make([]string, 0, len(c.Columns))
+	for _, col := range c.Columns {
+		if value := col.GetKey(key); value != NoColEntry && strings.TrimSpace(value) != "" {
+			res = append(res, value)
+		}
+	}
+	return res, nil
+}
+
+// Decimals parses the non-empty entries with the given row name with
+// ParseDecimal. An error is returned if key is not in the head or if an entry
+// is not a number.
+func (c *Collection) Decimals(key string, loc *Locale) ([]Decimal, error) {
+	if !c.hasKey(key) {
+		return nil, NewColKeyError("invalid key: %s, allowed keys are %s", key, strings.Join(c.Head, ", "))
+	}
+	res := make([]Decimal, 0, len(c.Columns))
+	for i, col := range c.Columns {
+		value := col.GetKey(key)
+		if value == NoColEntry || strings.TrimSpace(value) == "" {
+			continue
+		}
+		d, err := ParseDecimal(value, loc)
+		if err != nil {
+			return nil, fmt.Errorf("entry \"%s\" of column %d: %w", key, i+1, err)
+		}
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+// SumDecimals returns the exact sum of values, the scale is the maximal scale
+// of all values.
+func SumDecimals(values []Decimal) Decimal {
+	sum := Decimal{new(big.Rat), 0}
+	for _, d := range values {
+		sum.Value.Add(sum.Value, d.Rat())
+		if d.Scale > sum.Scale {
+			sum.Scale = d.Scale
+		}
+	}
+	return sum
+}
+
+// AvgDecimals returns the average of values. The scale is the maximal scale of
+// all values or more if required to represent the result (at most 10). An
+// error is returned if values is empty.
+func AvgDecimals(values []Decimal) (Decimal, error) {
+	if len(values) == 0 {
+		return Decimal{}, errors.New("can't compute the average of zero values")
+	}
+	sum := SumDecimals(values)
+	avg := new(big.Rat).Quo(sum.Rat(), big.NewRat(int64(len(values)), 1))
+	scale := decimalScale(avg)
+	if sum.Scale > scale {
+		scale = sum.Scale
+	}
+	return Decimal{avg, scale}, nil
+}
+
+// extremeDecimal returns the minimum (sign -1) or maximum (sign 1) of values.
+func extremeDecimal(values []Decimal, sign int) (Decimal, error) {
+	if len(values) == 0 {
+		return Decimal{}, errors.New("can't compute the minimum / maximum of zero values")
+	}
+	res := values[0]
+	for _, d := range values[1:] {
+		if d.Rat().Cmp(res.Rat()) == sign {
+			res = d
+		}
+	}
+	return res, nil
+}
+
+// MinDecimal returns the smallest value, an error is returned if values is
+// empty.
+func MinDecimal(values []Decimal) (Decimal, error) {
+	return extremeDecimal(values, -1)
+}
+
+// MaxDecimal returns the largest value, an error is returned if values is
+// empty.
+func MaxDecimal(values []Decimal) (Decimal, error) {
+	return extremeDecimal(values, 1)
+}
+
+// Sum returns the exact sum of all entries with the given row name, empty
+// entries are ignored. Numbers are parsed with ParseDecimal and . as decimal
+// separator, use Decimals for other locales.
+func (c *Collection) Sum(key string) (Decimal, error) {
+	values, err := c.Decimals(key, nil)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return SumDecimals(values), nil
+}
+
+// Avg returns the average of all entries with the given row name, see Sum.
+func (c *Collection) Avg(key string) (Decimal, error) {
+	values, err := c.Decimals(key, nil)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return AvgDecimals(values)
+}
+
+// Min returns the smallest entry with the given row name, see Sum.
+func (c *Collection) Min(key string) (Decimal, error) {
+	values, err := c.Decimals(key, nil)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return MinDecimal(values)
+}
+
+// Max returns the largest entry with the given row name, see Sum.
+func (c *Collection) Max(key string) (Decimal, error) {
+	values, err := c.Decimals(key, nil)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return MaxDecimal(values)
+}
+
+// Count returns the number of non-empty entries with the given row name.
+func (c *Collection) Count(key string) (int, error) {
+	values, err := c.Values(key)
+	if err != nil {
+		return 0, err
+	}
+	return len(values), nil
+}
+
+// CountDistinct returns the number of distinct non-empty entries with the given
+// row name. Entries are compared as strings.
+func (c *Collection) CountDistinct(key string) (int, error) {
+	values, err := c.Values(key)
+	if err != nil {
+		return 0, err
+	}
+	distinct := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		distinct[value] = struct{}{}
+	}
+	return len(distinct), nil
+}
+
+// aggregateArgs splits the arguments of an aggregate template function into
+// the row name and the collection, see collectionArgs.
+func aggregateArgs(name string, args []interface{}) (string, *Collection, error) {
+	strs, c, err := collectionArgs(name, args)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(strs) != 1 {
+		return "", nil, fmt.Errorf("%s expects 2 arguments, got %d", name, len(args))
+	}
+	return strs[0], c, nil
+}
+
+// Sum is the template function "sum", it works as Collection.Sum but parses
+// numbers with the locale of f. The arguments are the row name and a
+// collection, group or chunk.
+// Example: #(fixed 2 (sum "price" .data)#) or #(.data | sum "price"#).
+func (f *NumberFormat) Sum(args ...interface{}) (Decimal, error) {
+	key, c, err := aggregateArgs("sum", args)
+	if err != nil {
+		return Decimal{}, err
+	}
+	values, err := c.Decimals(key, f.Locale)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return SumDecimals(values), nil
+}
+
+// Avg is the template function "avg", see Sum.
+func (f *NumberFormat) Avg(args ...interface{}) (Decimal, error) {
+	key, c, err := aggregateArgs("avg", args)
+	if err != nil {
+		return Decimal{}, err
+	}
+	values, err := c.Decimals(key, f.Locale)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return AvgDecimals(values)
+}
+
+// Min is the template function "min", see Sum.
+func (f *NumberFormat) Min(args ...interface{}) (Decimal, error) {
+	key, c, err := aggregateArgs("min", args)
+	if err != nil {
+		return Decimal{}, err
+	}
+	values, err := c.Decimals(key, f.Locale)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return MinDecimal(values)
+}
+
+// Max is the template function "max", see Sum.
+func (f *NumberFormat) Max(args ...interface{}) (Decimal, error) {
+	key, c, err := aggregateArgs("max", args)
+	if err != nil {
+		return Decimal{}, err
+	}
+	values, err := c.Decimals(key, f.Locale)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return MaxDecimal(values)
+}
+
+// Count is the template function "count", it calls Collection.Count. The
+// arguments are as for NumberFormat.Sum.
+func Count(args ...interface{}) (int, error) {
+	key, c, err := aggregateArgs("count", args)
+	if err != nil {
+		return 0, err
+	}
+	return c.Count(key)
+}
+
+// CountDistinct is the template function "countDistinct", it calls
+// Collection.CountDistinct. The arguments are as for NumberFormat.Sum.
+func CountDistinct(args ...interface{}) (int, error) {
+	key, c, err := aggregateArgs("countDistinct", args)
+	if err != nil {
+		return 0, err
+	}
+	return c.CountDistinct(key)
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import "testing"
+
+// testCollection returns a collection with the given head and columns.
+func testCollection(t *testing.T, head []string, columns ...[]string) *Collection {
+	t.Helper()
+	c, err := NewCollection(NewMemoryCollection(head, columns))
+	if err != nil {
+		t.Fatalf("can't create collection: %v", err)
+	}
+	return c
+}
+
+// productCollection returns a small collection of products.
+func productCollection(t *testing.T) *Collection {
+	return testCollection(t, []string{"name", "cat", "price"},
+		[]string{"apple", "fruit", "1.5"},
+		[]string{"pear", "fruit", "2.25"},
+		[]string{"bread", "bakery", "3"},
+		[]string{"roll", "bakery", ""},
+	)
+}
+
+func TestAggregateFuncs(t *testing.T) {
+	data := map[string]interface{}{"data": productCollection(t)}
+	tests := []struct {
+		name, template, expected string
+	}{
+		{"sum", `#(sum "price" .data#)`, "6.75"},
+		{"sum pipeline", `#(.data | sum "price"#)`, "6.75"},
+		{"avg", `#(fixed 2 (avg "price" .data)#)`, "2.25"},
+		{"min max", `#(min "price" .data#) #(max "price" .data#)`, "1.5 3"},
+		{"count", `#(count "price" .data#) #(countDistinct "cat" .data#)`, "3 2"},
+		{"group", `#(range groupBy "cat" .data#)#(.Name#)=#(sum "price" .#);#(end#)`, "fruit=3.75;bakery=3;"},
+		{"group count", `#(range groupBy "cat" .data#)#(count "name" .#)#(end#)`, "22"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := executeTemplate(&TemplateOptions{}, data, test.template)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestAggregateErrors(t *testing.T) {
+	data := map[string]interface{}{"data": productCollection(t)}
+	for _, template := range []string{
+		`#(sum "foo" .data#)`,
+		`#(sum "price"#)`,
+		`#(sum "price" "data"#)`,
+		`#(avg "price" (where "cat" "none" .data)#)`,
+		`#(sum "name" .data#)`,
+	} {
+		if got, err := executeTemplate(&TemplateOptions{}, data, template); err == nil {
+			t.Errorf("%s: expected an error, got %q", template, got)
+		}
+	}
+}
@@ -0,0 +1,547 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// RawLatex is a string that contains trusted LaTeX code. Values of this type
+// are never escaped by the auto escaper, see AutoEscapeTemplate.
+// In a template a value can be marked as trusted with the "raw" function.
+type RawLatex string
+
+// LatexContext describes the LaTeX context in which a template action is
+// executed. The auto escaper chooses the escaping rules based on the context.
+type LatexContext int
+
+const (
+	// TextContext is normal text, for example the document body.
+	TextContext LatexContext = iota
+	// MathContext is math mode, for example $...$ or an equation environment.
+	MathContext
+	// URLContext is the argument of \url or the first argument of \href.
+	URLContext
+	// VerbatimContext is the content of \verb or a verbatim like environment.
+	VerbatimContext
+	// CommentContext is everything after a % until the end of the line.
+	CommentContext
+)
+
+func (ctx LatexContext) String() string {
+	switch ctx {
+	case TextContext:
+		return "text"
+	case MathContext:
+		return "math"
+	case URLContext:
+		return "url"
+	case VerbatimContext:
+		return "verbatim"
+	case CommentContext:
+		return "comment"
+	default:
+		return fmt.Sprintf("LatexContext(%d)", int(ctx))
+	}
+}
+
+var (
+	// mathEnvironments are all environments that switch to math mode.
+	mathEnvironments = map[string]bool{
+		"math":        true,
+		"displaymath": true,
+		"equation":    true,
+		"equation*":   true,
+		"align":       true,
+		"align*":      true,
+		"alignat":     true,
+		"alignat*":    true,
+		"flalign":     true,
+		"flalign*":    true,
+		"gather":      true,
+		"gather*":     true,
+		"multline":    true,
+		"multline*":   true,
+		"eqnarray":    true,
+		"eqnarray*":   true,
+	}
+
+	// verbatimEnvironments are all environments whose content is not
+	// interpreted by LaTeX.
+	verbatimEnvironments = map[string]bool{
+		"verbatim":   true,
+		"verbatim*":  true,
+		"Verbatim":   true,
+		"lstlisting": true,
+		"minted":     true,
+	}
+
+	// latexProducingFuncs maps the names of all template functions that
+	// already return valid LaTeX to the contexts their output is meant for.
+	// If such a function is the last command of an action in one of these
+	// contexts its output is not escaped again by the auto escaper, in all
+	// other contexts the action is rejected.
+	latexProducingFuncs = map[string][]LatexContext{
+		"latex":      {TextContext},
+		"latexnl":    {TextContext},
+		"mathlatex":  {MathContext},
+		"verb":       {TextContext},
+		"join":       {TextContext},
+		"url":        {TextContext},
+		"href":       {TextContext},
+		"smarttext":  {TextContext},
+		"markdown":   {TextContext},
+		"lstinline":  {TextContext},
+		"mintinline": {TextContext},
+		"codeblock":  {TextContext},
+		"num":        {TextContext, MathContext},
+		"fixed":      {TextContext, MathContext},
+		"percent":    {TextContext, MathContext},
+		"thousands":  {TextContext, MathContext},
+		"money":      {TextContext},
+		"table":      {TextContext},
+	}
+
+	// urlContextReplacer escapes values inside \url{} and \href{}. It works as
+	// EscapeURL but percent-encodes braces instead of validating them.
+	urlContextReplacer = strings.NewReplacer(
+		"%", `\%`,
+		"#", `\#`,
+		`\`, `\%5C`,
+		" ", `\%20`,
+		"{", `\%7B`,
+		"}", `\%7D`,
+		"\n", "",
+		"\r", "",
+	)
+
+	// commentContextReplacer makes sure that a value can't end a comment.
+	commentContextReplacer = strings.NewReplacer(
+		"\r\n", " ",
+		"\n", " ",
+		"\r", " ",
+	)
+)
+
+// latexState is the state of the scanner that computes the context of an
+// action. It is comparable and two states are equal iff their context is the
+// same.
+type latexState struct {
+	context LatexContext
+	// end is the sequence that terminates the current math or verbatim context.
+	end string
+	// depth is the brace depth in URLContext.
+	depth int
+	// outer is the context that is restored once a comment ends.
+	outer LatexContext
+}
+
+// readCommandName reads the name of a LaTeX command, text[i] must be the
+// backslash. It returns the name and the position after the name.
+// A name is either a sequence of letters or a single other character.
+func readCommandName(text string, i int) (string, int) {
+	start := i + 1
+	j := start
+	for j < len(text) && isASCIILetter(text[j]) {
+		j++
+	}
+	if j == start && j < len(text) {
+		j++
+	}
+	return text[start:j], j
+}
+
+func isASCIILetter(b byte) bool {
+	return ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+}
+
+// skipSpaces returns the position of the first non-space character in text
+// starting at i.
+func skipSpaces(text string, i int) int {
+	for i < len(text) && (text[i] == ' ' || text[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// advance returns the state after reading text.
+func (s latexState) advance(text string) latexState {
+	i := 0
+	for i < len(text) {
+		switch s.context {
+		case TextContext:
+			switch text[i] {
+			case '%':
+				s = latexState{context: CommentContext, outer: TextContext}
+				i++
+			case '$':
+				if strings.HasPrefix(text[i:], "$$") {
+					s = latexState{context: MathContext, end: "$$"}
+					i += 2
+				} else {
+					s = latexState{context: MathContext, end: "$"}
+					i++
+				}
+			case '\\':
+				s, i = s.advanceCommand(text, i)
+			default:
+				i++
+			}
+		case MathContext:
+			switch {
+			case strings.HasPrefix(text[i:], s.end):
+				i += len(s.end)
+				s = latexState{context: TextContext}
+			case text[i] == '\\':
+				i += 2
+			case text[i] == '%':
+				s = latexState{context: CommentContext, end: s.end, outer: MathContext}
+				i++
+			default:
+				i++
+			}
+		case URLContext:
+			switch text[i] {
+			case '\\':
+				i += 2
+			case '{':
+				s.depth++
+				i++
+			case '}':
+				s.depth--
+				i++
+				if s.depth == 0 {
+					s = latexState{context: TextContext}
+				}
+			default:
+				i++
+			}
+		case VerbatimContext:
+			pos := strings.Index(text[i:], s.end)
+			if pos < 0 {
+				return s
+			}
+			i += pos + len(s.end)
+			s = latexState{context: TextContext}
+		case CommentContext:
+			pos := strings.IndexByte(text[i:], '\n')
+			if pos < 0 {
+				return s
+			}
+			i += pos + 1
+			s = latexState{context: s.outer, end: s.end}
+		}
+	}
+	return s
+}
+
+// advanceCommand handles a command in TextContext, text[i] must be the
+// backslash.
+func (s latexState) advanceCommand(text string, i int) (latexState, int) {
+	name, next := readCommandName(text, i)
+	switch name {
+	case "(":
+		return latexState{context: MathContext, end: `\)`}, next
+	case "[":
+		return latexState{context: MathContext, end: `\]`}, next
+	case "url", "href":
+		pos := skipSpaces(text, next)
+		if pos < len(text) && text[pos] == '{' {
+			return latexState{context: URLContext, depth: 1}, pos + 1
+		}
+	case "verb":
+		pos := next
+		if pos < len(text) && text[pos] == '*' {
+			pos++
+		}
+		if pos < len(text) {
+			return latexState{context: VerbatimContext, end: text[pos : pos+1]}, pos + 1
+		}
+	case "begin":
+		pos := skipSpaces(text, next)
+		if pos < len(text) && text[pos] == '{' {
+			closing := strings.IndexByte(text[pos:], '}')
+			if closing >= 0 {
+				env := text[pos+1 : pos+closing]
+				end := pos + closing + 1
+				switch {
+				case mathEnvironments[env]:
+					return latexState{context: MathContext, end: `\end{` + env + `}`}, end
+				case verbatimEnvironments[env]:
+					return latexState{context: VerbatimContext, end: `\end{` + env + `}`}, end
+				}
+			}
+		}
+	}
+	return s, next
+}
+
+// AutoEscaper describes how the output of template actions is escaped in the
+// different LaTeX contexts, see AutoEscapeTemplate.
+//
+// Text is used in TextContext, Math in MathContext and URL in URLContext. Each
+// of them can be nil in which case the value is not changed. In TextContext the
+// newline policy is applied after escaping.
+// In VerbatimContext values are not changed but it is an error if they contain
+// the sequence that ends the verbatim context. In CommentContext line breaks are
+// replaced by spaces.
+type AutoEscaper struct {
+	Text     LatexEscapeFunc
+	Math     LatexEscapeFunc
+	URL      LatexEscapeFunc
+	Newlines NewlinePolicy
+}
+
+// NewAutoEscaper returns a new AutoEscaper that uses replace in text context,
+// MathEscapeWithDefaults in math context and escapes url arguments such that
+// they can't break out of \url or \href.
+// If replace is nil only url arguments are escaped.
+func NewAutoEscaper(replace LatexEscapeFunc) *AutoEscaper {
+	return &AutoEscaper{
+		Text: replace,
+		Math: mathEscapeFor(replace),
+		URL:  urlContextReplacer.Replace,
+	}
+}
+
+// autoEscapeFuncName is the name of the escaping function that is inserted into
+// each action.
+const autoEscapeFuncName = "_gummibaum_escape"
+
+// Escape escapes the value in the given context. end is the sequence that ends
+// the verbatim context and is ignored in all other contexts.
+func (esc *AutoEscaper) Escape(ctx LatexContext, end string, value interface{}) (string, error) {
+	var s string
+	var trusted, text bool
+	switch v := value.(type) {
+	case nil:
+		s = ""
+	case RawLatex:
+		s, trusted = string(v), true
+	case Text:
+		s, text = v.Plain, true
+	default:
+		s = plainString(v)
+	}
+	switch ctx {
+	case TextContext:
+		if trusted {
+			return s, nil
+		}
+		if text {
+			return esc.Newlines.Apply(escapeText(s, esc.Text))
+		}
+		return esc.Newlines.Apply(applyEscapeFunc(esc.Text, s, trusted))
+	case MathContext:
+		if text {
+			return escapeText(s, esc.Math), nil
+		}
+		return applyEscapeFunc(esc.Math, s, trusted), nil
+	case URLContext:
+		return applyEscapeFunc(esc.URL, s, trusted), nil
+	case VerbatimContext:
+		if strings.Contains(s, end) {
+			return "", fmt.Errorf("value in verbatim context contains the end sequence %s", end)
+		}
+		if len(end) == 1 && strings.ContainsAny(s, "\r\n") {
+			return "", fmt.Errorf(`value in \verb context contains a line break`)
+		}
+		return s, nil
+	case CommentContext:
+		return commentContextReplacer.Replace(s), nil
+	default:
+		return "", fmt.Errorf("invalid LaTeX context %s", ctx)
+	}
+}
+
+func applyEscapeFunc(f LatexEscapeFunc, s string, trusted bool) string {
+	if f == nil || trusted {
+		return s
+	}
+	return f(s)
+}
+
+// templateFunc returns the function that is registered under autoEscapeFuncName.
+// The context is passed as an int because the template package converts
+// numeric constants only to basic types.
+func (esc *AutoEscaper) templateFunc() func(ctx int, end string, value interface{}) (string, error) {
+	return func(ctx int, end string, value interface{}) (string, error) {
+		return esc.Escape(LatexContext(ctx), end, value)
+	}
+}
+
+// AutoEscapeTemplate rewrites all templates associated with t such that the
+// output of each action is escaped according to the LaTeX context the action
+// appears in. For example in "Hello #(.Name#)" .Name is escaped with esc.Text
+// and in "$x = #(.X#)$" .X is escaped with esc.Math.
+//
+// Values of type RawLatex (for example the result of "raw") are never
+// escaped. Actions that end with a function that already produces LaTeX are
+// not escaped again if the function produces output for the context: "latex",
+// "verb" etc. in text context, "mathlatex" in math context and the number
+// functions in text and math context. Using them in any other context is an
+// error, for example \url{#(latex .U#)} or $#(latex .X#)$: Escaping their
+// output again would not yield the intended result.
+//
+// The context is computed from the text surrounding the action. The branches
+// of if, with and range must end in the same context and the body of range must
+// not change the context. Templates are always escaped in text context, so
+// calling another template from a different context is an error.
+//
+// It must be called after the templates are parsed and before they are
+// executed. Calling it more than once has no additional effect.
+func AutoEscapeTemplate(t *template.Template, esc *AutoEscaper) error {
+	t.Funcs(template.FuncMap{autoEscapeFuncName: esc.templateFunc()})
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree == nil || tmpl.Tree.Root == nil {
+			continue
+		}
+		e := &treeEscaper{tree: tmpl.Tree}
+		if _, err := e.escapeList(latexState{context: TextContext}, tmpl.Tree.Root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// treeEscaper rewrites the actions of a single parse tree.
+type treeEscaper struct {
+	tree *parse.Tree
+}
+
+func (e *treeEscaper) errorf(node parse.Node, format string, a ...interface{}) error {
+	location, _ := e.tree.ErrorContext(node)
+	return fmt.Errorf("%s: %s", location, fmt.Sprintf(format, a...))
+}
+
+func (e *treeEscaper) escapeList(s latexState, list *parse.ListNode) (latexState, error) {
+	if list == nil {
+		return s, nil
+	}
+	for _, node := range list.Nodes {
+		var err error
+		s, err = e.escapeNode(s, node)
+		if err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+func (e *treeEscaper) escapeNode(s latexState, node parse.Node) (latexState, error) {
+	switch n := node.(type) {
+	case *parse.TextNode:
+		return s.advance(string(n.Text)), nil
+	case *parse.ActionNode:
+		return s, e.escapeAction(s, n)
+	case *parse.IfNode:
+		return e.escapeBranch(s, &n.BranchNode, "if", false)
+	case *parse.WithNode:
+		return e.escapeBranch(s, &n.BranchNode, "with", false)
+	case *parse.RangeNode:
+		return e.escapeBranch(s, &n.BranchNode, "range", true)
+	case *parse.ListNode:
+		return e.escapeList(s, n)
+	case *parse.TemplateNode:
+		if s.context != TextContext {
+			return s, e.errorf(n, "template %q called in %s context, templates can only be called in text context",
+				n.Name, s.context)
+		}
+		return s, nil
+	default:
+		return s, nil
+	}
+}
+
+func (e *treeEscaper) escapeBranch(s latexState, n *parse.BranchNode, name string, loop bool) (latexState, error) {
+	afterList, err := e.escapeList(s, n.List)
+	if err != nil {
+		return s, err
+	}
+	if loop && afterList != s {
+		return s, e.errorf(n, "body of %s starts in %s context but ends in %s context",
+			name, s.context, afterList.context)
+	}
+	afterElse, err := e.escapeList(s, n.ElseList)
+	if err != nil {
+		return s, err
+	}
+	if afterList != afterElse {
+		return s, e.errorf(n, "branches of %s end in different contexts (%s and %s)",
+			name, afterList.context, afterElse.context)
+	}
+	return afterList, nil
+}
+
+// escapeAction appends the escape function to the pipeline of the action.
+// It returns an error if the action ends with a function that produces LaTeX
+// for other contexts.
+func (e *treeEscaper) escapeAction(s latexState, n *parse.ActionNode) error {
+	// assignments don't produce any output
+	if len(n.Pipe.Decl) > 0 || len(n.Pipe.Cmds) == 0 {
+		return nil
+	}
+	last := n.Pipe.Cmds[len(n.Pipe.Cmds)-1]
+	if len(last.Args) > 0 {
+		if ident, ok := last.Args[0].(*parse.IdentifierNode); ok {
+			if ident.Ident == autoEscapeFuncName {
+				// already escaped
+				return nil
+			}
+			if contexts, produces := latexProducingFuncs[ident.Ident]; produces {
+				for _, ctx := range contexts {
+					if ctx == s.context {
+						return nil
+					}
+				}
+				return e.errorf(n, "%q produces LaTeX for %s context and can't be used in %s context",
+					ident.Ident, joinContexts(contexts), s.context)
+			}
+		}
+	}
+	ctxArg := strconv.Itoa(int(s.context))
+	cmd := &parse.CommandNode{
+		NodeType: parse.NodeCommand,
+		Pos:      n.Pos,
+		Args: []parse.Node{
+			parse.NewIdentifier(autoEscapeFuncName).SetTree(e.tree).SetPos(n.Pos),
+			&parse.NumberNode{NodeType: parse.NodeNumber, Pos: n.Pos, IsInt: true, Int64: int64(s.context), Text: ctxArg},
+			&parse.StringNode{NodeType: parse.NodeString, Pos: n.Pos, Quoted: strconv.Quote(s.end), Text: s.end},
+		},
+	}
+	n.Pipe.Cmds = append(n.Pipe.Cmds, cmd)
+	return nil
+}
+
+// joinContexts returns the names of the contexts separated by "and".
+func joinContexts(contexts []LatexContext) string {
+	names := make([]string, len(contexts))
+	for i, ctx := range contexts {
+		names[i] = ctx.String()
+	}
+	return strings.Join(names, " and ")
+}
+
+// ParseAutoEscapeTemplates works as ParseTemplates but additionally calls
+// AutoEscapeTemplate on the result. The auto escaper is created with
+// NewAutoEscaper(replace).
+func ParseAutoEscapeTemplates(replace LatexEscapeFunc, delimLeft, delimRight string, filenames ...string) (*template.Template, error) {
+	opts := &TemplateOptions{Replace: replace, AutoEscape: true}
+	return ParseTemplatesWithOptions(opts, delimLeft, delimRight, filenames...)
+}
@@ -0,0 +1,169 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// executeTemplate parses the templates (the first one is executed) with opts
+// and returns the output.
+func executeTemplate(opts *TemplateOptions, data interface{}, templates ...string) (string, error) {
+	fsys := make(fstest.MapFS, len(templates))
+	names := make([]string, len(templates))
+	for i, text := range templates {
+		names[i] = "t" + string(rune('0'+i)) + ".tex"
+		fsys[names[i]] = &fstest.MapFile{Data: []byte(text)}
+	}
+	t, err := ParseTemplatesFS(opts, "", "", fsys, names...)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func autoEscapeOptions() *TemplateOptions {
+	return &TemplateOptions{Replace: EscapeWithDefaults(nil), AutoEscape: true}
+}
+
+func TestAutoEscapeContexts(t *testing.T) {
+	data := map[string]interface{}{
+		"X":     "a_b & 50%",
+		"Tilde": "~",
+		"U":     "http://x.org/a_b#c d",
+		"Raw":   RawLatex(`\textbf{x}`),
+		"Multi": "a\nb",
+		"Verb":  "x|y",
+		"List":  []string{"a_1", "b_2"},
+	}
+	tests := []struct {
+		name, template, expected string
+	}{
+		{"text", `#(.X#)`, `a\_b \& 50\%`},
+		{"text raw", `#(.Raw#)`, `\textbf{x}`},
+		{"text raw function", `#(raw .X#)`, `a_b & 50%`},
+		{"math dollar", `$#(.X#)$`, `$a\_b \& 50\%$`},
+		{"math tilde", `$#(.Tilde#)$`, `$\sim $`},
+		{"math display", `$$#(.X#)$$ #(.X#)`, `$$a\_b \& 50\%$$ a\_b \& 50\%`},
+		{"math paren", `\(#(.Tilde#)\) #(.Tilde#)`, `\(\sim \) \textasciitilde `},
+		{"math env", `\begin{equation}#(.Tilde#)\end{equation}`, `\begin{equation}\sim \end{equation}`},
+		{"url", `\url{#(.U#)}`, `\url{http://x.org/a_b\#c\%20d}`},
+		{"href", `\href{#(.U#)}{#(.X#)}`, `\href{http://x.org/a_b\#c\%20d}{a\_b \& 50\%}`},
+		{"verbatim", `\begin{verbatim}#(.X#)\end{verbatim}`, `\begin{verbatim}a_b & 50%\end{verbatim}`},
+		{"verb", `\verb|#(.X#)|`, `\verb|a_b & 50%|`},
+		{"comment", "% #(.Multi#)\n#(.X#)", "% a b\n" + `a\_b \& 50\%`},
+		{"comment in math", "$x % #(.Multi#)\n#(.Tilde#)$", "$x % a b\n" + `\sim $`},
+		{"range in math", `$#(range .List#)#(.#)+#(end#)$`, `$a\_1+b\_2+$`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := executeTemplate(autoEscapeOptions(), data, test.template)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestAutoEscapeProducingFuncs(t *testing.T) {
+	data := map[string]interface{}{
+		"X": "a_b",
+		"T": "~",
+		"U": "http://x.org/a_b",
+	}
+	tests := []struct {
+		name, template, expected string
+	}{
+		{"latex in text", `#(latex .X#)`, `a\_b`},
+		{"mathlatex in math", `$#(mathlatex .T#)$`, `$\sim $`},
+		{"url in text", `#(url .U#)`, `\url{http://x.org/a_b}`},
+		{"fixed in text", `#(fixed 2 "1234.5"#)`, `1234.50`},
+		{"fixed in math", `$#(fixed 2 "1234.5"#)$`, `$1234.50$`},
+		{"plain in url", `\url{#(.U#)}`, `\url{http://x.org/a_b}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := executeTemplate(autoEscapeOptions(), data, test.template)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+	for _, template := range []string{
+		`\url{#(latex .U#)}`,
+		`$#(latex .T#)$`,
+		`#(mathlatex .T#)`,
+		`\verb|#(latex .X#)|`,
+		`\begin{verbatim}#(verb .X#)\end{verbatim}`,
+		`\href{#(url .U#)}{x}`,
+		`% #(money .X#)`,
+		`#(if true#)$#(markdown .X#)$#(end#)`,
+	} {
+		got, err := executeTemplate(autoEscapeOptions(), data, template)
+		if err == nil {
+			t.Errorf("%s: expected an error, got %q", template, got)
+		} else if !strings.Contains(err.Error(), "can't be used in") {
+			t.Errorf("%s: unexpected error: %v", template, err)
+		}
+	}
+}
+
+func TestAutoEscapeErrors(t *testing.T) {
+	data := map[string]interface{}{
+		"Verb":  "x|y",
+		"Multi": "a\nb",
+		"List":  []string{"a"},
+	}
+	tests := []struct {
+		name      string
+		templates []string
+	}{
+		{"verb end sequence", []string{`\verb|#(.Verb#)|`}},
+		{"verb line break", []string{`\verb|#(.Multi#)|`}},
+		{"template in math", []string{`$#(template "t1.tex" .#)$`, `x`}},
+		{"range changes context", []string{`#(range .List#)$#(end#)$`}},
+		{"branches differ", []string{`#(if .List#)$#(else#)#(end#)$`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, err := executeTemplate(autoEscapeOptions(), data, test.templates...); err == nil {
+				t.Errorf("expected an error, got %q", got)
+			}
+		})
+	}
+}
+
+func TestAutoEscapeTemplateInText(t *testing.T) {
+	got, err := executeTemplate(autoEscapeOptions(), map[string]string{"X": "a&b"},
+		`#(template "t1.tex" .#)`, `#(.X#)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := `a\&b`; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
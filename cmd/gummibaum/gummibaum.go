@@ -16,15 +16,19 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
-	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/FabianWe/gummibaum"
 )
@@ -62,11 +66,215 @@ func getWriter(path string) (io.Writer, func(), error) {
 	return f, done, nil
 }
 
-func openCSVExpand(path string) (*gummibaum.CSVReader, error) {
+// dataFlags are the command line options for reading data files, they're
+// used by expand and template.
+type dataFlags struct {
+	flags      *flag.FlagSet
+	jsonSep    *string
+	sheet      *string
+	headerRow  *int
+	csvDialect *string
+	separator  *string
+	quote      *string
+	comment    *string
+	lazyQuotes *bool
+	skipRows   *int
+	noHeader   *bool
+	encoding   *string
+}
+
+// addDataFlags adds the options for data files to flags.
+func addDataFlags(flags *flag.FlagSet) *dataFlags {
+	return &dataFlags{
+		flags:      flags,
+		jsonSep:    flags.String("json-separator", gummibaum.DefaultJSONSeparator, "Separator for the keys of nested objects in json data"),
+		sheet:      flags.String("sheet", "", "Sheet of xlsx and ods files: name or number starting with 1, defaults to the first sheet"),
+		headerRow:  flags.Int("header-row", 1, "Row of xlsx and ods files that contains the row names (rows before are skipped), 0 for no header"),
+		csvDialect: flags.String("csv-dialect", "", "Path to a json, yaml or toml file with the csv options (separator, quote, comment, lazy_quotes, skip_rows, header, encoding), flags given on the command line take precedence"),
+		separator:  flags.String("separator", ",", "Separator of csv files: a single character, tab or auto to detect it"),
+		quote:      flags.String("quote", "\"", "Quote character of csv files"),
+		comment:    flags.String("comment", "", "Lines in csv files starting with this character are ignored"),
+		lazyQuotes: flags.Bool("lazy-quotes", false, "Allow quotes in unquoted fields and non-doubled quotes in quoted fields of csv files"),
+		skipRows:   flags.Int("skip-rows", 0, "Number of lines skipped at the beginning of csv files"),
+		noHeader:   flags.Bool("no-header", false, "csv files have no header, the row names are col1, col2, ..."),
+		encoding:   flags.String("encoding", "utf-8", "Encoding of csv files: utf-8, utf-16, utf-16le, utf-16be, windows-1252 or latin-1"),
+	}
+}
+
+// csvOptions returns the csv dialect from the dialect file and the flags.
+func (d *dataFlags) csvOptions() gummibaum.CSVOptions {
+	opts := gummibaum.CSVOptions{Separator: ','}
+	if *d.csvDialect != "" {
+		var err error
+		if opts, err = gummibaum.CSVOptionsFromFile(*d.csvDialect); err != nil {
+			panic(err)
+		}
+	}
+	// without a dialect file all flags are used (the defaults are the same),
+	// otherwise only those given on the command line
+	set := make(map[string]bool)
+	d.flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	use := func(name string) bool {
+		return *d.csvDialect == "" || set[name]
+	}
+	parseRune := func(value string) rune {
+		r, err := gummibaum.ParseCSVRune(value)
+		if err != nil {
+			panic(err)
+		}
+		return r
+	}
+	if use("separator") {
+		opts.Separator = parseRune(*d.separator)
+	}
+	if use("quote") {
+		opts.Quote = parseRune(*d.quote)
+	}
+	if use("comment") {
+		opts.Comment = parseRune(*d.comment)
+	}
+	if use("lazy-quotes") {
+		opts.LazyQuotes = *d.lazyQuotes
+	}
+	if use("skip-rows") {
+		if *d.skipRows < 0 {
+			panic(fmt.Errorf("invalid skip-rows %d: Must be >= 0", *d.skipRows))
+		}
+		opts.SkipRows = *d.skipRows
+	}
+	if use("no-header") {
+		opts.NoHeader = *d.noHeader
+	}
+	if use("encoding") {
+		if _, err := gummibaum.LookupCSVEncoding(*d.encoding); err != nil {
+			panic(err)
+		}
+		opts.Encoding = *d.encoding
+	}
+	return opts
+}
+
+// openDataSource returns the collection source for the file, the format is
+// chosen by the file extension: .json files are read with NewJSONFileReader,
+// .xlsx and .ods files with NewXLSXFileReader and NewODSFileReader, all other
+// files as csv with the dialect from the flags.
+func openDataSource(path string, opts *dataFlags) (gummibaum.CollectionSource, error) {
+	sheetOpts := gummibaum.SpreadsheetOptions{
+		Sheet:     *opts.sheet,
+		HeaderRow: *opts.headerRow,
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return gummibaum.NewJSONFileReader(path, *opts.jsonSep)
+	case ".xlsx", ".xlsm":
+		return gummibaum.NewXLSXFileReader(path, sheetOpts)
+	case ".ods":
+		return gummibaum.NewODSFileReader(path, sheetOpts)
+	default:
+		return gummibaum.NewCSVFileReaderWithOptions(path, opts.csvOptions())
+	}
+}
+
+// openSQLite runs the query on the sqlite database.
+func openSQLite(db, query string) (gummibaum.CollectionSource, error) {
+	if query == "" {
+		return nil, errors.New("--sqlite requires a --query")
+	}
+	reader, err := gummibaum.NewSQLiteFileReader(db, query)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite database \"%s\": %w", db, err)
+	}
+	return reader, nil
+}
+
+func openDataExpand(path string, opts *dataFlags, db, query string) (gummibaum.CollectionSource, error) {
+	if len(db) > 0 {
+		return openSQLite(db, query)
+	}
 	if len(path) == 0 {
 		return nil, nil
 	}
-	return gummibaum.NewCSVFileReader(path, ',', true)
+	return openDataSource(path, opts)
+}
+
+// queryNameRx matches the name of a query given as name=query.
+var queryNameRx = regexp.MustCompile(`^\s*([\w-]+)\s*=`)
+
+// parseQueryFlag parses a --query value of the form name=query or query, in
+// the later case the name is defaultName.
+func parseQueryFlag(value, defaultName string) (string, string) {
+	if match := queryNameRx.FindStringSubmatch(value); match != nil {
+		return match[1], value[len(match[0]):]
+	}
+	return defaultName, value
+}
+
+// collectionName returns the name of the collection from the given file in
+// template mode: The base name without extension.
+func collectionName(file string) string {
+	base := filepath.Base(file)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// parseEscapeProfile returns the escape profile given on the command line, it
+// returns a disabled profile if noEscape is true.
+func parseEscapeProfile(profileName string, noEscape bool) *gummibaum.EscapeProfile {
+	if noEscape {
+		return &gummibaum.EscapeProfile{Disabled: true}
+	}
+	profile, profileErr := gummibaum.LookupEscapeProfile(profileName)
+	if profileErr != nil {
+		panic(profileErr)
+	}
+	return profile
+}
+
+// referenceTime returns the time used for "now": The time parsed from value if
+// it is not empty, otherwise the unix time from $SOURCE_DATE_EPOCH if set and
+// the zero time (current time) if not.
+func referenceTime(dates *gummibaum.DateFormat, value string) time.Time {
+	if value != "" {
+		t, err := dates.Parse("", value)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		seconds, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			panic(fmt.Errorf("invalid SOURCE_DATE_EPOCH \"%s\": %v", epoch, err))
+		}
+		return time.Unix(seconds, 0).UTC()
+	}
+	return time.Time{}
+}
+
+// templateSearchPath returns the search path for the given directories, it
+// panics if a directory does not exist.
+func templateSearchPath(dirs []string) []fs.FS {
+	res := make([]fs.FS, len(dirs))
+	for i, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			panic(err)
+		}
+		if !info.IsDir() {
+			panic(fmt.Errorf("template directory \"%s\" is not a directory", dir))
+		}
+		res[i] = os.DirFS(dir)
+	}
+	return res
+}
+
+func parseNewlinePolicy(name string) gummibaum.NewlinePolicy {
+	policy, policyErr := gummibaum.ParseNewlinePolicy(name)
+	if policyErr != nil {
+		panic(policyErr)
+	}
+	return policy
 }
 
 // sorry, really ugly code
@@ -77,19 +285,30 @@ func expand(args []string) {
 	var rowFlag arrayFlags
 	expansion.Var(&rowFlag, "row", "replace variable / row name pair: var=row-name")
 	fileFlag := expansion.String("file", "", "Input template file")
-	noEscape := expansion.Bool("no-escape", false, "Set to true to globally suppress LaTeX escaping of input")
+	noEscape := expansion.Bool("no-escape", false, "Set to true to globally suppress LaTeX escaping of input, same as --escape=none")
+	escapeProfile := expansion.String("escape", "default", "Escape profile: default, pdflatex, xelatex, lualatex, none or a json / yaml file")
 	outFilePath := expansion.String("out", "", "If given write to a file instead of std out. Must be a directory if single-file is false")
 	singleFile := expansion.Bool("single-file", true, "If a collection is inserted output to a single file")
-	dataSource := expansion.String("csv", "", "Path to the csv file containing the data")
-	config := expansion.String("config", "", "Path to a json file containing the config")
+	dataSource := expansion.String("data", "", "Path to the file containing the data (csv, json, xlsx or ods)")
+	csvSource := expansion.String("csv", "", "Path to the csv file containing the data, same as --data")
+	dataOpts := addDataFlags(expansion)
+	sqliteDB := expansion.String("sqlite", "", "Path to a sqlite database, the data is the result of --query")
+	query := expansion.String("query", "", "SQL query for the data from --sqlite")
+	config := expansion.String("config", "", "Path to a json, yaml or toml file containing the config")
+	newline := expansion.String("newline", "keep", "How line breaks in values are handled: keep, break, newline, par, space or reject")
+	var newlineForFlag arrayFlags
+	expansion.Var(&newlineForFlag, "newline-for", "newline policy for a single placeholder: var=policy")
 	expansion.Parse(args)
-	// first parse config from json if given
-	var jsonConst, jsonRows map[string]string
+	if *dataSource == "" {
+		dataSource = csvSource
+	}
+	// first parse config file if given
+	var configConst, configRows map[string]string
 	if len(*config) > 0 {
-		var jsonErr error
-		jsonConst, jsonRows, jsonErr = gummibaum.ExpandConfigFromJSONFile(*config)
-		if jsonErr != nil {
-			panic(jsonErr)
+		var configErr error
+		configConst, configRows, configErr = gummibaum.ExpandConfigFromFile(*config)
+		if configErr != nil {
+			panic(configErr)
 		}
 	}
 	constMap, constMapErr := gummibaum.ParseVarValList(constFlag)
@@ -101,16 +320,33 @@ func expand(args []string) {
 		panic(rowMapErr)
 	}
 	// now update both maps, values from the command line take precedence
-	constMap = gummibaum.MergeStringMaps(jsonConst, constMap)
-	rowMap = gummibaum.MergeStringMaps(jsonRows, rowMap)
-	var replacer gummibaum.LatexEscapeFunc
-	if !*noEscape {
-		replacer = gummibaum.LatexEscapeFromList(gummibaum.DefaultReplacers)
+	constMap = gummibaum.MergeStringMaps(configConst, constMap)
+	rowMap = gummibaum.MergeStringMaps(configRows, rowMap)
+	newlinePolicy := parseNewlinePolicy(*newline)
+	newlineForMap, newlineForErr := gummibaum.ParseVarValList(newlineForFlag)
+	if newlineForErr != nil {
+		panic(newlineForErr)
+	}
+	placeholderNewlines := make(map[string]gummibaum.NewlinePolicy, len(newlineForMap))
+	for placeholder, policyName := range newlineForMap {
+		placeholderNewlines[placeholder] = parseNewlinePolicy(policyName)
+	}
+	profile := parseEscapeProfile(*escapeProfile, *noEscape)
+	modifiers := gummibaum.DefaultExpandModifiers()
+	modifiers["math"] = gummibaum.NewMathModifier(profile.MathEscapeFunc())
+	opts := &gummibaum.ExpandOptions{
+		Replace:             profile.EscapeFunc(),
+		Modifiers:           modifiers,
+		Newlines:            newlinePolicy,
+		PlaceholderNewlines: placeholderNewlines,
+	}
+	constHandler, constHandlerErr := gummibaum.NewConstHandlerWithOptions(constMap, opts)
+	if constHandlerErr != nil {
+		panic(constHandlerErr)
 	}
-	constHandler := gummibaum.NewConstHandler(constMap, replacer)
 	var rowHandler *gummibaum.RowHandler
 	if len(rowMap) > 0 {
-		rowHandler = gummibaum.NewRowHandler(rowMap, replacer)
+		rowHandler = gummibaum.NewRowHandlerWithOptions(rowMap, opts)
 	}
 	if *fileFlag == "" {
 		panic("No file provided")
@@ -152,9 +388,9 @@ func expand(args []string) {
 			}
 			defer done()
 			// apply each row in head
-			csv, csvErr := openCSVExpand(*dataSource)
-			if csvErr != nil {
-				panic(csvErr)
+			source, sourceErr := openDataExpand(*dataSource, dataOpts, *sqliteDB, *query)
+			if sourceErr != nil {
+				panic(sourceErr)
 			}
 			for _, line := range head {
 				_, writeErr := gummibaum.WriteExpandHandlers(out, line, constHandler)
@@ -163,15 +399,18 @@ func expand(args []string) {
 				}
 			}
 			// iterate body
-			if csv != nil {
+			if source != nil {
 				// iterate each row and apply handlers
-				collection, collectionErr := gummibaum.NewCollection(csv)
+				collection, collectionErr := gummibaum.NewCollection(source)
 				if collectionErr != nil {
 					panic(collectionErr)
 				}
 				for _, col := range collection.Columns {
 					// create new row handler with col, that's how we should use it
-					newRowHandler := rowHandler.WithColumn(col)
+					newRowHandler, rowHandlerErr := rowHandler.ForColumn(col)
+					if rowHandlerErr != nil {
+						panic(rowHandlerErr)
+					}
 					// now apply handlers for each line in body
 					for _, line := range body {
 						_, writeErr := gummibaum.WriteExpandHandlers(out, line, constHandler, newRowHandler)
@@ -190,15 +429,15 @@ func expand(args []string) {
 			}
 		} else {
 			// now outfile must be a directory
-			csv, csvErr := openCSVExpand(*dataSource)
-			if csvErr != nil {
-				panic(csvErr)
+			source, sourceErr := openDataExpand(*dataSource, dataOpts, *sqliteDB, *query)
+			if sourceErr != nil {
+				panic(sourceErr)
 			}
-			if csv == nil {
+			if source == nil {
 				return
 			}
 			// now iterate each column
-			collection, collectionErr := gummibaum.NewCollection(csv)
+			collection, collectionErr := gummibaum.NewCollection(source)
 			if collectionErr != nil {
 				panic(collectionErr)
 			}
@@ -223,7 +462,11 @@ func expand(args []string) {
 				}
 				// apply body with current column
 				// create new row handler with col, that's how we should use it
-				newRowHandler := rowHandler.WithColumn(col)
+				newRowHandler, rowHandlerErr := rowHandler.ForColumn(col)
+				if rowHandlerErr != nil {
+					outFile.Close()
+					panic(rowHandlerErr)
+				}
 				for _, line := range body {
 					_, writeErr := gummibaum.WriteExpandHandlers(outFile, line, constHandler, newRowHandler)
 					if writeErr != nil {
@@ -250,42 +493,92 @@ func template(args []string) {
 	collectionMap := make(map[string]*gummibaum.Collection)
 	templateFlags := flag.NewFlagSet("template", flag.ExitOnError)
 	var constFileFlag arrayFlags
-	templateFlags.Var(&constFileFlag, "const-file", "Path to a file containing const values (json)")
+	templateFlags.Var(&constFileFlag, "const-file", "Path to a file containing const values (json, yaml or toml)")
 	var collectionFileFlag arrayFlags
 	templateFlags.Var(&collectionFileFlag, "csv", "Path to a csv file containing a data collection")
+	var dataFileFlag arrayFlags
+	templateFlags.Var(&dataFileFlag, "data", "Path to a file (csv, json, xlsx or ods) containing a data collection, the name is the file name without extension")
+	dataOpts := addDataFlags(templateFlags)
+	sqliteDB := templateFlags.String("sqlite", "", "Path to a sqlite database for the data collections from --query")
+	var queryFlag arrayFlags
+	templateFlags.Var(&queryFlag, "query", "SQL query for --sqlite: name=query or query (the name is the database file name without extension), can be repeated")
 	var constFlag arrayFlags
 	templateFlags.Var(&constFlag, "const", "replace variable / value pair: var=value")
 	outFilePath := templateFlags.String("out", "", "If given write to a file instead of std out.")
-	noEscape := templateFlags.Bool("no-escape", false, "Set to true to globally suppress LaTeX escaping of input")
+	noEscape := templateFlags.Bool("no-escape", false, "Set to true to globally suppress LaTeX escaping of input, same as --escape=none")
+	escapeProfile := templateFlags.String("escape", "default", "Escape profile: default, pdflatex, xelatex, lualatex, none or a json / yaml file")
+	autoEscape := templateFlags.Bool("auto-escape", false, "Escape the output of each action according to its LaTeX context (text, math, url, verbatim, comment)")
+	quotes := templateFlags.String("quotes", "english", "Quote style for smarttext: english, german or csquotes")
+	newline := templateFlags.String("newline", "keep", "How line breaks are handled by latex: keep, break, newline, par, space or reject")
+	localeName := templateFlags.String("locale", "en-US", "Locale for number, date and currency formatting, for example en-US, de-DE or fr-FR")
+	rounding := templateFlags.String("rounding", "half-up", "Rounding mode for fixed and percent: half-up, half-even, down or up")
+	siunitx := templateFlags.Bool("siunitx", false, "Format numbers with the siunitx commands \\num and \\SI")
+	var dateLayoutFlag arrayFlags
+	templateFlags.Var(&dateLayoutFlag, "date-layout", "Layout for parsing dates (Go syntax, for example 02.01.2006), can be repeated")
+	excelDates := templateFlags.Bool("excel-dates", false, "Parse numbers as Excel serial dates if no date layout matches")
+	var templateDirFlag arrayFlags
+	templateFlags.Var(&templateDirFlag, "template-dir", "Directory with templates that can be used with template \"name\" (partials, base templates), can be repeated")
+	nowFlag := templateFlags.String("now", "", "Fixed date for now (for example 2024-03-01), defaults to $SOURCE_DATE_EPOCH or the current time")
 	templateFlags.Parse(args)
-	var replacer gummibaum.LatexEscapeFunc
-	if !*noEscape {
-		replacer = gummibaum.LatexEscapeFromList(gummibaum.DefaultReplacers)
+	profile := parseEscapeProfile(*escapeProfile, *noEscape)
+	quoteStyle, quoteStyleErr := gummibaum.ParseQuoteStyle(*quotes)
+	if quoteStyleErr != nil {
+		panic(quoteStyleErr)
+	}
+	locale, localeErr := gummibaum.LookupLocale(*localeName)
+	if localeErr != nil {
+		panic(localeErr)
+	}
+	roundingMode, roundingErr := gummibaum.ParseRoundingMode(*rounding)
+	if roundingErr != nil {
+		panic(roundingErr)
 	}
+	dates := gummibaum.DateFormat{
+		Locale:       locale,
+		Layouts:      dateLayoutFlag,
+		ExcelSerials: *excelDates,
+	}
+	dates.Now = referenceTime(&dates, *nowFlag)
 	w, done, wErr := getWriter(*outFilePath)
 	if wErr != nil {
 		panic(wErr)
 	}
 	defer done()
 	for _, constPath := range constFileFlag {
-		nextConstMap, nextConstErr := gummibaum.TemplateConstFromJSONFile(constPath)
+		nextConstMap, nextConstErr := gummibaum.TemplateConstFromFile(constPath)
 		if nextConstErr != nil {
 			panic(nextConstErr)
 		}
 		constMap = gummibaum.MergeStringMaps(constMap, nextConstMap)
 	}
-	for _, csvPath := range collectionFileFlag {
-		nextCSV, csvErr := gummibaum.NewCSVFileReader(csvPath, ',', true)
-		if csvErr != nil {
-			panic(csvErr)
+	for _, dataPath := range append(collectionFileFlag, dataFileFlag...) {
+		nextSource, sourceErr := openDataSource(dataPath, dataOpts)
+		if sourceErr != nil {
+			panic(sourceErr)
 		}
-		nextCollection, collectionErr := gummibaum.NewCollection(nextCSV)
+		nextCollection, collectionErr := gummibaum.NewCollection(nextSource)
 		if collectionErr != nil {
 			panic(collectionErr)
 		}
-		base := path.Base(csvPath)
-		base = strings.TrimSuffix(base, ".csv")
-		collectionMap[base] = nextCollection
+		collectionMap[collectionName(dataPath)] = nextCollection
+	}
+	if *sqliteDB == "" && len(queryFlag) > 0 {
+		panic("--query requires --sqlite")
+	}
+	if *sqliteDB != "" && len(queryFlag) == 0 {
+		panic("--sqlite requires a --query")
+	}
+	for _, queryValue := range queryFlag {
+		name, query := parseQueryFlag(queryValue, collectionName(*sqliteDB))
+		nextSource, sourceErr := openSQLite(*sqliteDB, query)
+		if sourceErr != nil {
+			panic(sourceErr)
+		}
+		nextCollection, collectionErr := gummibaum.NewCollection(nextSource)
+		if collectionErr != nil {
+			panic(collectionErr)
+		}
+		collectionMap[name] = nextCollection
 	}
 	cmdArgs, cmdArgsErr := gummibaum.ParseVarValList(constFlag)
 	if cmdArgsErr != nil {
@@ -293,7 +586,24 @@ func template(args []string) {
 	}
 	constMap = gummibaum.MergeStringMaps(constMap, cmdArgs)
 	filenames := templateFlags.Args()
-	template, templateErr := gummibaum.ParseTemplates(replacer, "", "", filenames...)
+	opts := &gummibaum.TemplateOptions{
+		Replace:     profile.EscapeFunc(),
+		MathReplace: profile.MathEscapeFunc(),
+		Quotes:      quoteStyle,
+		Newlines:    parseNewlinePolicy(*newline),
+		AutoEscape:  *autoEscape,
+		Numbers: gummibaum.NumberFormat{
+			Locale:   locale,
+			Rounding: roundingMode,
+			SIUnitX:  *siunitx,
+		},
+		Dates:      dates,
+		SearchPath: templateSearchPath(templateDirFlag),
+		Warn: func(w gummibaum.TemplateWarning) {
+			log.Println("Warning:", w)
+		},
+	}
+	template, templateErr := gummibaum.ParseTemplatesWithOptions(opts, "", "", filenames...)
 	if templateErr != nil {
 		panic(templateErr)
 	}
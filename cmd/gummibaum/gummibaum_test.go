@@ -0,0 +1,38 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FabianWe/gummibaum"
+)
+
+func TestReferenceTime(t *testing.T) {
+	dates := &gummibaum.DateFormat{Locale: gummibaum.GermanLocale}
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	if got := referenceTime(dates, ""); !got.IsZero() {
+		t.Errorf("expected the zero time, got %v", got)
+	}
+	t.Setenv("SOURCE_DATE_EPOCH", "1709251200")
+	if got, expected := referenceTime(dates, ""), time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC); !got.Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	// --now takes precedence over $SOURCE_DATE_EPOCH
+	if got, expected := referenceTime(dates, "2. März 2024"), time.Date(2024, time.March, 2, 0, 0, 0, 0, time.UTC); !got.Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// InlineDelimiters are the delimiters that are tried (in this order) by
+// ChooseDelimiter.
+var InlineDelimiters = []string{"|", "!", "+", "/", "@", "=", ":", ";", "\"", "'", "-", "?", "^", "~", ".", ","}
+
+// ChooseDelimiter returns the first delimiter from InlineDelimiters that does
+// not occur in s. It returns an error if s contains all delimiters or a line
+// break (inline code can't span multiple lines).
+func ChooseDelimiter(s string) (string, error) {
+	if strings.ContainsAny(s, "\r\n") {
+		return "", errors.New("inline code must not contain a line break")
+	}
+	for _, del := range InlineDelimiters {
+		if !strings.Contains(s, del) {
+			return del, nil
+		}
+	}
+	return "", fmt.Errorf("can't find a delimiter for inline code \"%s\"", s)
+}
+
+// Lstinline returns a \lstinline command (listings package) with a delimiter
+// chosen by ChooseDelimiter. If two arguments are given the first one is the
+// language and the second one the code, otherwise the code is the
+// concatenation of all arguments.
+// Example: Lstinline("Go", "a|b") yields to \lstinline[language=Go]!a|b!.
+func Lstinline(args ...interface{}) (string, error) {
+	var options string
+	if len(args) == 2 {
+		options = fmt.Sprintf("[language=%v]", args[0])
+		args = args[1:]
+	}
+	code := LatexEscaper(nil)(args...)
+	del, err := ChooseDelimiter(code)
+	if err != nil {
+		return "", err
+	}
+	return `\lstinline` + options + del + code + del, nil
+}
+
+// Mintinline returns a \mintinline command (minted package) for the given
+// language with a delimiter chosen by ChooseDelimiter. The code is the
+// concatenation of args.
+// Example: Mintinline("go", "a|b") yields to \mintinline{go}!a|b!.
+func Mintinline(language string, args ...interface{}) (string, error) {
+	code := LatexEscaper(nil)(args...)
+	del, err := ChooseDelimiter(code)
+	if err != nil {
+		return "", err
+	}
+	return `\mintinline{` + language + `}` + del + code + del, nil
+}
+
+// CodeBlock returns an environment containing code. env must be "lstlisting"
+// (listings package) or "minted" (minted package), language is the language of
+// the code. For lstlisting it can be empty.
+// The code is the concatenation of args. An error is returned if the code
+// contains the end of the environment (for example \end{lstlisting}, also with
+// spaces as in \end {lstlisting}).
+//
+// Example: CodeBlock("minted", "go", code) yields to
+//
+//	\begin{minted}{go}
+//	code
+//	\end{minted}
+func CodeBlock(env, language string, args ...interface{}) (string, error) {
+	code := strings.Trim(LatexEscaper(nil)(args...), "\r\n")
+	end := `\end{` + env + `}`
+	// spaces are allowed, for example \end {lstlisting}
+	endRegexp := regexp.MustCompile(`\\end\s*\{\s*` + regexp.QuoteMeta(env) + `\s*\}`)
+	if endRegexp.MatchString(code) {
+		return "", fmt.Errorf(`code must not contain %s`, end)
+	}
+	var begin string
+	switch env {
+	case "lstlisting":
+		begin = `\begin{lstlisting}`
+		if language != "" {
+			begin += "[language=" + language + "]"
+		}
+	case "minted":
+		if language == "" {
+			return "", errors.New("minted requires a language")
+		}
+		begin = `\begin{minted}{` + language + `}`
+	default:
+		return "", fmt.Errorf("invalid code environment \"%s\": Must be lstlisting or minted", env)
+	}
+	return begin + "\n" + code + "\n" + end, nil
+}
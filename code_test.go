@@ -0,0 +1,86 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChooseDelimiter(t *testing.T) {
+	tests := []struct {
+		code, expected string
+	}{
+		{"a+b", "|"},
+		{"a|b", "!"},
+		{"a|b!c", "+"},
+		{"|!+/@=:;\"'-?^~.", ","},
+	}
+	for _, test := range tests {
+		got, err := ChooseDelimiter(test.code)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.code, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.code, test.expected, got)
+		}
+	}
+	for _, code := range []string{strings.Join(InlineDelimiters, ""), "a\nb", "a\r"} {
+		if got, err := ChooseDelimiter(code); err == nil {
+			t.Errorf("%q: expected an error, got %q", code, got)
+		}
+	}
+}
+
+func TestCodeFuncs(t *testing.T) {
+	data := map[string]string{"Code": "x := a|b", "Block": "\nfmt.Println(\"}\")\n"}
+	tests := []struct {
+		name, template, expected string
+	}{
+		{"lstinline", `#(lstinline .Code#)`, `\lstinline!x := a|b!`},
+		{"lstinline language", `#(lstinline "Go" .Code#)`, `\lstinline[language=Go]!x := a|b!`},
+		{"lstinline concatenation", `#(lstinline "a" "b" "c"#)`, `\lstinline|a b c|`},
+		{"mintinline", `#(mintinline "go" .Code#)`, `\mintinline{go}!x := a|b!`},
+		{"lstlisting", `#(codeblock "lstlisting" "" .Block#)`, "\\begin{lstlisting}\nfmt.Println(\"}\")\n\\end{lstlisting}"},
+		{"lstlisting language", `#(codeblock "lstlisting" "Go" .Block#)`, "\\begin{lstlisting}[language=Go]\nfmt.Println(\"}\")\n\\end{lstlisting}"},
+		{"minted", `#(codeblock "minted" "go" .Block#)`, "\\begin{minted}{go}\nfmt.Println(\"}\")\n\\end{minted}"},
+		{"other environment", `#(codeblock "minted" "latex" "\\end{lstlisting}"#)`, "\\begin{minted}{latex}\n\\end{lstlisting}\n\\end{minted}"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := executeTemplate(autoEscapeOptions(), data, test.template)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+	for _, template := range []string{
+		`#(lstinline "a\nb"#)`,
+		`#(codeblock "lstlisting" "" "a\n\\end{lstlisting}"#)`,
+		`#(codeblock "lstlisting" "" "a\\end {lstlisting}"#)`,
+		`#(codeblock "lstlisting" "" "\\end{ lstlisting }"#)`,
+		`#(codeblock "minted" "go" "\\end	{minted}"#)`,
+		`#(codeblock "minted" "" "x"#)`,
+		`#(codeblock "verbatim" "" "x"#)`,
+	} {
+		if got, err := executeTemplate(autoEscapeOptions(), data, template); err == nil {
+			t.Errorf("%s: expected an error, got %q", template, got)
+		}
+	}
+}
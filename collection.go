@@ -126,6 +126,7 @@ func (c *Column) Value(key string) (string, error) {
 	i := 0
 	for key, _ := range c.Map {
 		validKeys[i] = key
+		i++
 	}
 	return "", NewColKeyError("invalid key: %s, allowed keys are %s", key, strings.Join(validKeys, ", "))
 }
@@ -16,9 +16,21 @@ package gummibaum
 
 import (
 	"encoding/csv"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+	"gopkg.in/yaml.v3"
 )
 
 // CSVReader implements CollectionSource by reading content as csv.
@@ -85,3 +97,286 @@ func (r *CSVReader) Head() ([]string, error) {
 func (r *CSVReader) Entries() ([][]string, error) {
 	return r.ColumnsContent, nil
 }
+
+// CSVEncodings maps the names of the supported input encodings to the
+// encoding, see CSVOptions.
+var CSVEncodings = map[string]encoding.Encoding{
+	"utf-8":        unicode.UTF8,
+	"utf-16":       unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+	"utf-16le":     unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"utf-16be":     unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"windows-1252": charmap.Windows1252,
+	"latin-1":      charmap.ISO8859_1,
+	"iso-8859-1":   charmap.ISO8859_1,
+}
+
+// LookupCSVEncoding returns the encoding with the given name from
+// CSVEncodings (case insensitive, "_" can be used instead of "-"). The empty
+// string is UTF-8.
+func LookupCSVEncoding(name string) (encoding.Encoding, error) {
+	normalized := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "_", "-")
+	switch normalized {
+	case "", "utf8":
+		normalized = "utf-8"
+	case "cp1252":
+		normalized = "windows-1252"
+	case "latin1":
+		normalized = "latin-1"
+	}
+	if enc, has := CSVEncodings[normalized]; has {
+		return enc, nil
+	}
+	return nil, fmt.Errorf("invalid encoding \"%s\": Must be utf-8, utf-16, utf-16le, utf-16be, windows-1252 or latin-1", name)
+}
+
+// CSVSniffSeparators are the separators that are tried if the separator of a
+// csv file is detected automatically.
+var CSVSniffSeparators = []rune{',', ';', '\t', '|'}
+
+// CSVOptions describes the dialect of a csv file. The zero value describes a
+// UTF-8 file with a head and an automatically detected separator.
+type CSVOptions struct {
+	// Separator separates the fields, it is detected with SniffCSVSeparator
+	// if it is 0.
+	Separator rune
+	// Quote is the quote character, " is used if it is 0.
+	Quote rune
+	// Comment starts a comment line if it is not 0.
+	Comment rune
+	// LazyQuotes allows quotes in unquoted fields and non-doubled quotes in
+	// quoted fields.
+	LazyQuotes bool
+	// SkipRows is the number of lines that are skipped at the beginning of the
+	// file (before the head).
+	SkipRows int
+	// NoHeader is true if the file has no head, the row names are col1,
+	// col2, ... in this case.
+	NoHeader bool
+	// Encoding is the name of the input encoding, see LookupCSVEncoding. A
+	// byte order mark is always removed.
+	Encoding string
+}
+
+// ParseCSVRune parses a character option of CSVOptions: A single character,
+// "tab" for a tabulator or "" (and "auto" for the separator, "none" for the
+// comment) for 0.
+func ParseCSVRune(s string) (rune, error) {
+	switch strings.ToLower(s) {
+	case "", "auto", "none":
+		return 0, nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	if utf8.RuneCountInString(s) != 1 {
+		return 0, fmt.Errorf("invalid csv character \"%s\": Must be a single character or tab", s)
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return r, nil
+}
+
+// SniffCSVSeparator returns the separator from CSVSniffSeparators that occurs
+// the same number of times (at least once) in most of the first lines of text,
+// quoted text is ignored. If there are several candidates the separator with
+// more fields is used, if no separator occurs at all ',' is returned.
+func SniffCSVSeparator(text string) rune {
+	lines := strings.Split(text, "\n")
+	if len(lines) > 20 {
+		lines = lines[:20]
+	}
+	best, bestScore, bestCount := ',', 0, 0
+	for _, sep := range CSVSniffSeparators {
+		counts := make(map[int]int)
+		for _, line := range lines {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			count, quoted := 0, false
+			for _, r := range line {
+				switch {
+				case r == '"':
+					quoted = !quoted
+				case r == sep && !quoted:
+					count++
+				}
+			}
+			if count > 0 {
+				counts[count]++
+			}
+		}
+		for count, score := range counts {
+			if score > bestScore || (score == bestScore && count > bestCount) {
+				best, bestScore, bestCount = sep, score, count
+			}
+		}
+	}
+	return best
+}
+
+// NewCSVReaderWithOptions works as NewCSVReader but reads the csv with the
+// given dialect.
+func NewCSVReaderWithOptions(r io.Reader, opts CSVOptions) (*CSVReader, error) {
+	enc, err := LookupCSVEncoding(opts.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(transform.NewReader(r, enc.NewDecoder()))
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimPrefix(string(content), "\ufeff")
+	for i := 0; i < opts.SkipRows && text != ""; i++ {
+		if pos := strings.IndexByte(text, '\n'); pos >= 0 {
+			text = text[pos+1:]
+		} else {
+			text = ""
+		}
+	}
+	quote := opts.Quote
+	if quote == 0 {
+		quote = '"'
+	}
+	// encoding/csv only supports " as quote character, so the quote
+	// character and " are swapped before parsing and swapped back afterwards
+	var swap *strings.Replacer
+	if quote != '"' {
+		swap = strings.NewReplacer(string(quote), `"`, `"`, string(quote))
+		text = swap.Replace(text)
+	}
+	sep := opts.Separator
+	if sep == 0 {
+		sep = SniffCSVSeparator(text)
+	}
+	csvReader := csv.NewReader(strings.NewReader(text))
+	csvReader.Comma = sep
+	csvReader.Comment = opts.Comment
+	csvReader.LazyQuotes = opts.LazyQuotes
+	// allow columns of different size
+	csvReader.FieldsPerRecord = -1
+	allEntries, entriesErr := csvReader.ReadAll()
+	if entriesErr != nil {
+		return nil, entriesErr
+	}
+	if swap != nil {
+		for _, entries := range allEntries {
+			for i, entry := range entries {
+				entries[i] = swap.Replace(entry)
+			}
+		}
+	}
+	var headContent []string
+	if opts.NoHeader {
+		n := 0
+		for _, entries := range allEntries {
+			n = IntMax(n, len(entries))
+		}
+		headContent = make([]string, n)
+		for i := range headContent {
+			headContent[i] = fmt.Sprintf("col%d", i+1)
+		}
+	} else {
+		// head must be the first entry
+		if len(allEntries) == 0 {
+			return nil, errors.New("can't read head from csv, does not contain any row")
+		}
+		headContent = allEntries[0]
+		allEntries = allEntries[1:]
+	}
+	return &CSVReader{
+			HeadContent:    headContent,
+			ColumnsContent: allEntries,
+		},
+		nil
+}
+
+// NewCSVFileReaderWithOptions returns a new csv reader given a file path and
+// the dialect.
+func NewCSVFileReaderWithOptions(file string, opts CSVOptions) (*CSVReader, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	var reader *CSVReader
+	defer func() {
+		closeErr := f.Close()
+		if err == nil && closeErr != nil {
+			reader = nil
+			err = closeErr
+		}
+	}()
+	reader, err = NewCSVReaderWithOptions(f, opts)
+	return reader, err
+}
+
+// csvOptionsContent is the content of a dialect file, see CSVOptionsFromFile.
+type csvOptionsContent struct {
+	Separator  string `json:"separator" yaml:"separator" toml:"separator"`
+	Quote      string `json:"quote" yaml:"quote" toml:"quote"`
+	Comment    string `json:"comment" yaml:"comment" toml:"comment"`
+	LazyQuotes bool   `json:"lazy_quotes" yaml:"lazy_quotes" toml:"lazy_quotes"`
+	SkipRows   int    `json:"skip_rows" yaml:"skip_rows" toml:"skip_rows"`
+	Header     bool   `json:"header" yaml:"header" toml:"header"`
+	Encoding   string `json:"encoding" yaml:"encoding" toml:"encoding"`
+}
+
+func (content *csvOptionsContent) options() (CSVOptions, error) {
+	var opts CSVOptions
+	var err error
+	if opts.Separator, err = ParseCSVRune(content.Separator); err != nil {
+		return opts, err
+	}
+	if opts.Quote, err = ParseCSVRune(content.Quote); err != nil {
+		return opts, err
+	}
+	if opts.Comment, err = ParseCSVRune(content.Comment); err != nil {
+		return opts, err
+	}
+	if _, err = LookupCSVEncoding(content.Encoding); err != nil {
+		return opts, err
+	}
+	if content.SkipRows < 0 {
+		return opts, fmt.Errorf("invalid skip_rows %d: Must be >= 0", content.SkipRows)
+	}
+	opts.LazyQuotes = content.LazyQuotes
+	opts.SkipRows = content.SkipRows
+	opts.NoHeader = !content.Header
+	opts.Encoding = content.Encoding
+	return opts, nil
+}
+
+// CSVOptionsFromFile reads a csv dialect from a json, yaml (".yaml" or
+// ".yml") or toml (".toml") file. All entries are optional: "separator"
+// (default ",", "auto" to detect it), "quote", "comment", "lazy_quotes",
+// "skip_rows", "header" (default true) and "encoding".
+//
+// Example (yaml): separator: ";" and encoding: windows-1252.
+func CSVOptionsFromFile(file string) (CSVOptions, error) {
+	content := csvOptionsContent{Separator: ",", Header: true}
+	f, err := os.Open(file)
+	if err != nil {
+		return CSVOptions{}, err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		if err = dec.Decode(&content); err == io.EOF {
+			err = nil
+		}
+	case ".toml":
+		var meta toml.MetaData
+		if meta, err = toml.NewDecoder(f).Decode(&content); err == nil {
+			if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+				err = fmt.Errorf("unknown key \"%s\" in csv dialect", undecoded[0])
+			}
+		}
+	default:
+		dec := json.NewDecoder(f)
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&content)
+	}
+	if err != nil {
+		return CSVOptions{}, fmt.Errorf("csv dialect \"%s\": %w", file, err)
+	}
+	return content.options()
+}
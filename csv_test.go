@@ -0,0 +1,198 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestSniffCSVSeparator(t *testing.T) {
+	tests := []struct {
+		name, text string
+		expected   rune
+	}{
+		{"comma", "a,b,c\n1,2,3\n", ','},
+		{"semicolon", "name;price\napple;1,50\npear;2,25\n", ';'},
+		{"tab", "a\tb\n1\t2\n", '\t'},
+		{"pipe", "a|b|c\n1|2|3", '|'},
+		{"quoted", "\"a;b\",c\n\"1;2\",3\n\"x;y\",z\n", ','},
+		{"more fields", "a,b;c;d\n1,2;3;4\n", ';'},
+		{"blank lines", "a;b\n\n1;2\n\n", ';'},
+		{"none", "foo\nbar\n", ','},
+		{"empty", "", ','},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := SniffCSVSeparator(test.text); got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestLookupCSVEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected interface{}
+	}{
+		{"", unicode.UTF8},
+		{"UTF8", unicode.UTF8},
+		{" utf_8 ", unicode.UTF8},
+		{"cp1252", charmap.Windows1252},
+		{"Windows-1252", charmap.Windows1252},
+		{"latin1", charmap.ISO8859_1},
+		{"ISO_8859_1", charmap.ISO8859_1},
+	}
+	for _, test := range tests {
+		got, err := LookupCSVEncoding(test.name)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.name, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("%q: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+	for _, name := range []string{"ascii", "utf-32", "latin-2"} {
+		if _, err := LookupCSVEncoding(name); err == nil {
+			t.Errorf("%q: expected an error", name)
+		}
+	}
+}
+
+func TestParseCSVRune(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected rune
+	}{
+		{"", 0},
+		{"auto", 0},
+		{"None", 0},
+		{"tab", '\t'},
+		{`\t`, '\t'},
+		{";", ';'},
+		{"ä", 'ä'},
+	}
+	for _, test := range tests {
+		got, err := ParseCSVRune(test.s)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.s, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.s, test.expected, got)
+		}
+	}
+	if _, err := ParseCSVRune(";;"); err == nil {
+		t.Error("expected an error for more than one character")
+	}
+}
+
+func TestNewCSVReaderWithOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  []byte
+		opts     CSVOptions
+		head     []string
+		expected [][]string
+	}{
+		{"sniff", []byte("name;price\napple;\"1,50\"\n"), CSVOptions{},
+			[]string{"name", "price"}, [][]string{{"apple", "1,50"}}},
+		{"utf-8 bom", []byte("\xef\xbb\xbfname,price\nbäcker,2\n"), CSVOptions{},
+			[]string{"name", "price"}, [][]string{{"bäcker", "2"}}},
+		{"windows-1252", []byte("name;price\nb\xe4cker;2 \x80\n"), CSVOptions{Encoding: "windows-1252"},
+			[]string{"name", "price"}, [][]string{{"bäcker", "2 €"}}},
+		{"latin-1", []byte("name\nstra\xdfe\n"), CSVOptions{Encoding: "latin1"},
+			[]string{"name"}, [][]string{{"straße"}}},
+		{"utf-16 bom", []byte("\xff\xfen\x00,\x00p\x00\n\x00\xe4\x00,\x001\x00\n\x00"), CSVOptions{Encoding: "utf-16"},
+			[]string{"n", "p"}, [][]string{{"ä", "1"}}},
+		{"skip rows", []byte("exported by foo\n\nname,price\napple,1\n"), CSVOptions{SkipRows: 2},
+			[]string{"name", "price"}, [][]string{{"apple", "1"}}},
+		{"no header", []byte("a,b\nc\n"), CSVOptions{NoHeader: true},
+			[]string{"col1", "col2"}, [][]string{{"a", "b"}, {"c"}}},
+		{"quote and comment", []byte("# comment\nname|note\n'a|b'|'say \"hi\"'\n"), CSVOptions{Separator: '|', Quote: '\'', Comment: '#'},
+			[]string{"name", "note"}, [][]string{{"a|b", `say "hi"`}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader, err := NewCSVReaderWithOptions(bytes.NewReader(test.content), test.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(reader.HeadContent, test.head) {
+				t.Errorf("expected head %q, got %q", test.head, reader.HeadContent)
+			}
+			if !reflect.DeepEqual(reader.ColumnsContent, test.expected) {
+				t.Errorf("expected columns %q, got %q", test.expected, reader.ColumnsContent)
+			}
+		})
+	}
+	for _, opts := range []CSVOptions{{Encoding: "ascii"}, {SkipRows: 5}} {
+		if _, err := NewCSVReaderWithOptions(strings.NewReader("a,b\n1,2\n"), opts); err == nil {
+			t.Errorf("expected an error for options %+v", opts)
+		}
+	}
+}
+
+func TestCSVOptionsFromFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		file, content string
+		expected      CSVOptions
+	}{
+		{"dialect.yaml", "separator: \";\"\nencoding: windows-1252\n", CSVOptions{Separator: ';', Encoding: "windows-1252"}},
+		{"dialect.toml", "separator = \"tab\"\nheader = false\nskip_rows = 1\n", CSVOptions{Separator: '\t', NoHeader: true, SkipRows: 1}},
+		{"dialect.json", `{"separator": "auto", "quote": "'", "lazy_quotes": true}`, CSVOptions{Quote: '\'', LazyQuotes: true}},
+		{"empty.yml", "", CSVOptions{Separator: ','}},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, test.file)
+		if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatalf("can't write dialect: %v", err)
+		}
+		got, err := CSVOptionsFromFile(path)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.file, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.file, test.expected, got)
+		}
+	}
+	for name, content := range map[string]string{
+		"unknown.yaml":  "sep: \";\"\n",
+		"unknown.toml":  "sep = \";\"\n",
+		"unknown.json":  `{"sep": ";"}`,
+		"encoding.json": `{"encoding": "ascii"}`,
+		"skip.json":     `{"skip_rows": -1}`,
+		"rune.json":     `{"separator": ";;"}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("can't write dialect: %v", err)
+		}
+		if _, err := CSVOptionsFromFile(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultDateLayouts are the layouts (see package time) that are tried by
+// DateFormat.Parse if no layouts are configured.
+var DefaultDateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"02.01.2006",
+	"2.1.2006",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"01/02/2006",
+	"2006/01/02",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2. January 2006",
+	"2 Jan 2006",
+	"2. Jan 2006",
+}
+
+// ExcelLayout is the name of the "layout" for Excel serial dates, for example
+// 45352 is 2024-03-01.
+const ExcelLayout = "excel"
+
+// excelSerial matches Excel serial dates.
+var excelSerial = regexp.MustCompile(`^\d+(\.\d+)?$`)
+
+// ParseExcelDate parses an Excel serial date (days since 1899-12-30, a
+// fraction describes the time of the day) in the given location, UTC if loc
+// is nil. Serials before March 1900 consider that Excel counts 1900-02-29.
+func ParseExcelDate(s string, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	s = strings.TrimSpace(s)
+	if !excelSerial.MatchString(s) {
+		return time.Time{}, fmt.Errorf("invalid Excel date \"%s\"", s)
+	}
+	r, _ := new(big.Rat).SetString(s)
+	days := new(big.Int).Quo(r.Num(), r.Denom())
+	if !days.IsInt64() {
+		return time.Time{}, fmt.Errorf("invalid Excel date \"%s\"", s)
+	}
+	fraction := new(big.Rat).Sub(r, new(big.Rat).SetInt(days))
+	seconds, _ := new(big.Rat).Mul(fraction, big.NewRat(24*60*60, 1)).Float64()
+	n := int(days.Int64())
+	if n < 61 {
+		n++
+	}
+	base := time.Date(1899, time.December, 30, 0, 0, 0, 0, loc)
+	return base.AddDate(0, 0, n).Add(time.Duration(seconds+0.5) * time.Second), nil
+}
+
+// DateFormat describes how dates are parsed and formatted by the functions
+// "date", "parseDate" and "now".
+type DateFormat struct {
+	// Locale defines the names of months and weekdays, if it is nil
+	// EnglishLocale is used.
+	Locale *Locale
+	// Layouts are the layouts that are tried when parsing a date, if it is
+	// empty DefaultDateLayouts is used.
+	Layouts []string
+	// ExcelSerials enables parsing Excel serial dates if no layout matches.
+	ExcelSerials bool
+	// Location is the time zone of dates without a time zone, if it is nil UTC
+	// is used.
+	Location *time.Location
+	// Now is the time returned by "now", if it is the zero time the current time
+	// is used. Set it to get reproducible documents.
+	Now time.Time
+}
+
+func (f *DateFormat) locale() *Locale {
+	if f.Locale == nil {
+		return EnglishLocale
+	}
+	return f.Locale
+}
+
+func (f *DateFormat) location() *time.Location {
+	if f.Location == nil {
+		return time.UTC
+	}
+	return f.Location
+}
+
+// englishNames replaces localized month and weekday names in s by their
+// English names, this way they can be parsed with package time.
+func englishNames(s string, loc *Locale) string {
+	if loc.Months == englishMonths && loc.Days == englishDays {
+		return s
+	}
+	// translate returns the English name and true if it is an abbreviation
+	translate := func(word string) (string, bool) {
+		for i := range loc.Months {
+			if strings.EqualFold(word, loc.Months[i]) {
+				return englishMonths[i], false
+			}
+			if strings.EqualFold(word, loc.ShortMonths[i]) {
+				return englishShortMonths[i], true
+			}
+		}
+		for i := range loc.Days {
+			if strings.EqualFold(word, loc.Days[i]) {
+				return englishDays[i], false
+			}
+			if strings.EqualFold(word, loc.ShortDays[i]) {
+				return englishShortDays[i], true
+			}
+		}
+		return word, false
+	}
+	var b strings.Builder
+	var word []rune
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			word = append(word, r)
+			continue
+		}
+		translated, abbreviation := translate(string(word))
+		b.WriteString(translated)
+		word = word[:0]
+		// drop the dot after an abbreviation (Feb.)
+		if r != '.' || !abbreviation {
+			b.WriteRune(r)
+		}
+	}
+	translated, _ := translate(string(word))
+	b.WriteString(translated)
+	return b.String()
+}
+
+// Parse parses value with the given layout. If layout is empty all layouts
+// from f.Layouts are tried and, if enabled, Excel serial dates. The layout
+// ExcelLayout parses an Excel serial date. Localized month and weekday names
+// are accepted.
+func (f *DateFormat) Parse(layout, value string) (time.Time, error) {
+	loc := f.location()
+	value = strings.TrimSpace(value)
+	if layout == ExcelLayout {
+		return ParseExcelDate(value, loc)
+	}
+	translated := englishNames(value, f.locale())
+	if layout != "" {
+		return time.ParseInLocation(f.layout(layout), translated, loc)
+	}
+	layouts := f.Layouts
+	if len(layouts) == 0 {
+		layouts = DefaultDateLayouts
+	}
+	for _, l := range layouts {
+		if t, err := time.ParseInLocation(l, translated, loc); err == nil {
+			return t, nil
+		}
+	}
+	if f.ExcelSerials && excelSerial.MatchString(value) {
+		return ParseExcelDate(value, loc)
+	}
+	return time.Time{}, fmt.Errorf("can't parse \"%s\" as date", value)
+}
+
+// ParseDate parses a date for templates. With one argument the argument is
+// parsed with all layouts, with two arguments the first one is the layout.
+// Example: #(parseDate "02.01.2006" .Date#).
+func (f *DateFormat) ParseDate(args ...interface{}) (time.Time, error) {
+	var layout string
+	var value interface{}
+	switch len(args) {
+	case 1:
+		value = args[0]
+	case 2:
+		layout, value = plainString(args[0]), args[1]
+	default:
+		return time.Time{}, fmt.Errorf("parseDate expects one or two arguments, got %d", len(args))
+	}
+	if t, ok := value.(time.Time); ok {
+		return t, nil
+	}
+	return f.Parse(layout, plainString(value))
+}
+
+// layout returns the layout for the names "iso", "short" and "long" (the
+// latter two from the locale), all other layouts are returned unchanged.
+func (f *DateFormat) layout(name string) string {
+	switch name {
+	case "iso":
+		return "2006-01-02"
+	case "short":
+		return f.locale().ShortDate
+	case "long":
+		return f.locale().LongDate
+	default:
+		return name
+	}
+}
+
+// nameTokens are the layout elements with names, longer tokens first.
+var nameTokens = []string{"January", "Monday", "Jan", "Mon"}
+
+// Format formats t with layout. layout is a layout for package time or one of
+// "iso", "short" and "long". Month and weekday names are translated.
+func (f *DateFormat) Format(layout string, t time.Time) string {
+	layout = f.layout(layout)
+	loc := f.locale()
+	var b strings.Builder
+	start := 0
+	for i := 0; i < len(layout); {
+		token := ""
+		for _, candidate := range nameTokens {
+			if strings.HasPrefix(layout[i:], candidate) {
+				token = candidate
+				break
+			}
+		}
+		if token == "" {
+			i++
+			continue
+		}
+		if start < i {
+			b.WriteString(t.Format(layout[start:i]))
+		}
+		switch token {
+		case "January":
+			b.WriteString(loc.Months[t.Month()-1])
+		case "Jan":
+			b.WriteString(loc.ShortMonths[t.Month()-1])
+		case "Monday":
+			b.WriteString(loc.Days[t.Weekday()])
+		case "Mon":
+			b.WriteString(loc.ShortDays[t.Weekday()])
+		}
+		i += len(token)
+		start = i
+	}
+	if start < len(layout) {
+		b.WriteString(t.Format(layout[start:]))
+	}
+	return b.String()
+}
+
+// Date formats a date for templates. value is either a time.Time or parsed
+// with ParseDate.
+// Example: #(date "long" .Date#) yields to 1. März 2024 for a German locale.
+func (f *DateFormat) Date(layout string, value interface{}) (string, error) {
+	t, err := f.ParseDate(value)
+	if err != nil {
+		return "", err
+	}
+	return f.Format(layout, t), nil
+}
+
+// DateText returns the template function "date", it works as Date but returns
+// a Text. This way the result (for example the localized name of a month) is
+// escaped with replace, which may transliterate it.
+func (f *DateFormat) DateText(replace LatexEscapeFunc) func(layout string, value interface{}) (Text, error) {
+	return func(layout string, value interface{}) (Text, error) {
+		s, err := f.Date(layout, value)
+		if err != nil {
+			return Text{}, err
+		}
+		return newText(s, replace), nil
+	}
+}
+
+// CurrentTime returns f.Now if it is set and the current time otherwise.
+func (f *DateFormat) CurrentTime() time.Time {
+	if f.Now.IsZero() {
+		return time.Now().In(f.location())
+	}
+	return f.Now
+}
@@ -0,0 +1,219 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDateParse(t *testing.T) {
+	march := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		loc           *Locale
+		layout, value string
+		expected      time.Time
+	}{
+		{nil, "", "2024-03-01", march},
+		{nil, "", "01.03.2024", march},
+		{nil, "", "March 1, 2024", march},
+		{nil, "", "2024-03-01 13:30", time.Date(2024, time.March, 1, 13, 30, 0, 0, time.UTC)},
+		{nil, "iso", "2024-03-01", march},
+		{nil, "short", "03/01/2024", march},
+		{BritishLocale, "short", "01/03/2024", march},
+		{GermanLocale, "", "1. März 2024", march},
+		{GermanLocale, "", "1. märz 2024", march},
+		{GermanLocale, "long", "1. März 2024", march},
+		{GermanLocale, "2. Jan 2006", "1. Mär. 2024", march},
+		{GermanLocale, "Monday, 2. January 2006", "Freitag, 1. März 2024", march},
+		{FrenchLocale, "", "1 mars 2024", march},
+		{FrenchLocale, "2 Jan 2006", "3 févr. 2024", time.Date(2024, time.February, 3, 0, 0, 0, 0, time.UTC)},
+		{FrenchLocale, "Monday 2 January 2006", "vendredi 1 mars 2024", march},
+		{nil, ExcelLayout, "45352", march},
+	}
+	for _, test := range tests {
+		f := DateFormat{Locale: test.loc}
+		got, err := f.Parse(test.layout, test.value)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.value, err)
+			continue
+		}
+		if !got.Equal(test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.value, test.expected, got)
+		}
+	}
+	for _, value := range []string{"2024-13-01", "1. März 2024", "45352", ""} {
+		if got, err := (&DateFormat{}).Parse("", value); err == nil {
+			t.Errorf("%q: expected an error, got %v", value, got)
+		}
+	}
+}
+
+func TestDateParseLocation(t *testing.T) {
+	zone := time.FixedZone("UTC+1", 60*60)
+	f := DateFormat{Location: zone, ExcelSerials: true}
+	for _, value := range []string{"2024-03-01", "45352"} {
+		got, err := f.Parse("", value)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", value, err)
+		}
+		if expected := time.Date(2024, time.March, 1, 0, 0, 0, 0, zone); !got.Equal(expected) {
+			t.Errorf("%q: expected %v, got %v", value, expected, got)
+		}
+	}
+}
+
+func TestParseExcelDate(t *testing.T) {
+	tests := []struct {
+		serial   string
+		expected time.Time
+	}{
+		{"45352", time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)},
+		{" 45352.5 ", time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)},
+		{"45352.75", time.Date(2024, time.March, 1, 18, 0, 0, 0, time.UTC)},
+		{"0", time.Date(1899, time.December, 31, 0, 0, 0, 0, time.UTC)},
+		{"1", time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"59", time.Date(1900, time.February, 28, 0, 0, 0, 0, time.UTC)},
+		// Excel counts the non-existing 1900-02-29
+		{"60", time.Date(1900, time.March, 1, 0, 0, 0, 0, time.UTC)},
+		{"61", time.Date(1900, time.March, 1, 0, 0, 0, 0, time.UTC)},
+		{"62", time.Date(1900, time.March, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		got, err := ParseExcelDate(test.serial, nil)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.serial, err)
+			continue
+		}
+		if !got.Equal(test.expected) || got.Location() != time.UTC {
+			t.Errorf("%q: expected %v, got %v", test.serial, test.expected, got)
+		}
+	}
+	for _, serial := range []string{"", "-1", "1e5", "abc", "1.", "99999999999999999999999"} {
+		if got, err := ParseExcelDate(serial, nil); err == nil {
+			t.Errorf("%q: expected an error, got %v", serial, got)
+		}
+	}
+}
+
+func TestDateFormat(t *testing.T) {
+	date := time.Date(2024, time.March, 1, 13, 5, 0, 0, time.UTC)
+	tests := []struct {
+		loc              *Locale
+		layout, expected string
+	}{
+		{nil, "iso", "2024-03-01"},
+		{nil, "short", "03/01/2024"},
+		{nil, "long", "March 1, 2024"},
+		{BritishLocale, "long", "1 March 2024"},
+		{GermanLocale, "short", "01.03.2024"},
+		{GermanLocale, "long", "1. März 2024"},
+		{GermanLocale, "Mon, 2. Jan 2006 15:04", "Fr, 1. Mär 2024 13:05"},
+		{GermanLocale, "Monday", "Freitag"},
+		{FrenchLocale, "long", "1 mars 2024"},
+		{FrenchLocale, "Monday 2 January 2006", "vendredi 1 mars 2024"},
+		{FrenchLocale, "2 Jan", "1 mars"},
+		{SwissLocale, "long", "1. März 2024"},
+	}
+	for _, test := range tests {
+		f := DateFormat{Locale: test.loc}
+		if got := f.Format(test.layout, date); got != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.layout, test.expected, got)
+		}
+	}
+}
+
+func TestDateFuncs(t *testing.T) {
+	data := map[string]interface{}{
+		"Date":   "2024-02-03",
+		"German": "03.02.2024",
+		"Time":   time.Date(2024, time.December, 24, 0, 0, 0, 0, time.UTC),
+	}
+	opts := &TemplateOptions{Dates: DateFormat{
+		Locale: GermanLocale,
+		Now:    time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC),
+	}}
+	tests := []struct {
+		name, template, expected string
+	}{
+		{"date", `#(date "long" .Date#)`, "3. Februar 2024"},
+		{"date time", `#(date "short" .Time#)`, "24.12.2024"},
+		{"parseDate", `#(date "iso" (parseDate "02.01.2006" .German)#)`, "2024-02-03"},
+		{"now", `#(date "long" now#) #((now).Year#)`, "1. März 2024 2024"},
+		{"now layout", `#(date "15:04" now#)`, "09:00"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := executeTemplate(opts, data, test.template)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+	for _, template := range []string{
+		`#(date "long" "foo"#)`,
+		`#(parseDate "iso" .German#)`,
+		`#(parseDate "iso" .Date .Date#)`,
+	} {
+		if got, err := executeTemplate(opts, data, template); err == nil {
+			t.Errorf("%s: expected an error, got %q", template, got)
+		}
+	}
+}
+
+func TestCurrentTime(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	if got := (&DateFormat{Now: now}).CurrentTime(); !got.Equal(now) {
+		t.Errorf("expected %v, got %v", now, got)
+	}
+	zone := time.FixedZone("UTC+1", 60*60)
+	before := time.Now()
+	got := (&DateFormat{Location: zone}).CurrentTime()
+	if got.Before(before.Add(-time.Second)) || got.Location() != zone {
+		t.Errorf("expected the current time in %v, got %v", zone, got)
+	}
+}
+
+func TestLookupLocale(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected *Locale
+	}{
+		{"en", EnglishLocale},
+		{"en-GB", BritishLocale},
+		{"en_AU", EnglishLocale},
+		{"de_DE", GermanLocale},
+		{"de-CH", SwissLocale},
+		{"FR", FrenchLocale},
+	}
+	for _, test := range tests {
+		got, err := LookupLocale(test.name)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("%s: got the wrong locale", test.name)
+		}
+	}
+	for _, name := range []string{"", "xx", "-de"} {
+		if _, err := LookupLocale(name); err == nil {
+			t.Errorf("%q: expected an error", name)
+		}
+	}
+}
@@ -21,7 +21,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
 )
 
 // ParseVarValPair parses a string of the form var=val. It returns var and val.
@@ -66,16 +70,179 @@ func ApplyExpandHandlers(line string, handlers ...ExpandHandler) string {
 	return s
 }
 
-// WriteExpandHandlers works as ApplyExpandHandlers but writes the result
+// ExpandErrHandler is an ExpandHandler that can report errors. HandleLine
+// usually panics in the cases where HandleLineErr returns an error.
+type ExpandErrHandler interface {
+	ExpandHandler
+	HandleLineErr(line string) (string, error)
+}
+
+// ApplyExpandHandlersErr works as ApplyExpandHandlers but uses HandleLineErr
+// for handlers that implement ExpandErrHandler. It returns the first error
+// that occurred.
+func ApplyExpandHandlersErr(line string, handlers ...ExpandHandler) (string, error) {
+	s := line
+	for _, handler := range handlers {
+		if errHandler, ok := handler.(ExpandErrHandler); ok {
+			var err error
+			s, err = errHandler.HandleLineErr(s)
+			if err != nil {
+				return "", err
+			}
+		} else {
+			s = handler.HandleLine(s)
+		}
+	}
+	return s, nil
+}
+
+// WriteExpandHandlers works as ApplyExpandHandlersErr but writes the result
 // to a writer. It returns the number of bytes written and any error that
 // occurred.
 func WriteExpandHandlers(w io.Writer, line string, handlers ...ExpandHandler) (int, error) {
-	return fmt.Fprintln(w, ApplyExpandHandlers(line, handlers...))
+	s, err := ApplyExpandHandlersErr(line, handlers...)
+	if err != nil {
+		return 0, err
+	}
+	return fmt.Fprintln(w, s)
+}
+
+// ExpandModifierSeparator separates a placeholder from the name of a modifier,
+// for example "REPL-VALUE|math".
+const ExpandModifierSeparator = "|"
+
+// ExpandModifier transforms the value of a placeholder that is followed by a
+// modifier name, see ExpandModifierSeparator. This way the same value can be
+// used in different contexts. replace is the escape function of the handler
+// and can be nil.
+type ExpandModifier func(value string, replace LatexEscapeFunc) (string, error)
+
+// MathModifier escapes value for math mode with MathEscapeWithDefaults. If
+// replace is nil the value is not changed. Use NewMathModifier for another
+// escape function.
+func MathModifier(value string, replace LatexEscapeFunc) (string, error) {
+	if math := mathEscapeFor(replace); math != nil {
+		return math(value), nil
+	}
+	return value, nil
+}
+
+// NewMathModifier returns a modifier that escapes values with math, for
+// example the result of EscapeProfile.MathEscapeFunc. If replace is nil the
+// value is not changed.
+func NewMathModifier(math LatexEscapeFunc) ExpandModifier {
+	return func(value string, replace LatexEscapeFunc) (string, error) {
+		if replace == nil || math == nil {
+			return value, nil
+		}
+		return math(value), nil
+	}
+}
+
+// DefaultExpandModifiers returns the modifiers supported in expand mode:
+// "math" (MathModifier), "url" (URLModifier), "md" (MarkdownModifier) and for
+// the newline policies "break", "newline", "par" and "space" (see
+// NewlinePolicy.Modifier).
+func DefaultExpandModifiers() map[string]ExpandModifier {
+	return map[string]ExpandModifier{
+		"math":    MathModifier,
+		"url":     URLModifier,
+		"md":      MarkdownModifier,
+		"break":   NewlineBreak.Modifier(),
+		"newline": NewlineNewline.Modifier(),
+		"par":     NewlinePar.Modifier(),
+		"space":   NewlineSpace.Modifier(),
+	}
+}
+
+// ExpandOptions configures ConstHandler and RowHandler.
+type ExpandOptions struct {
+	// Replace is used to escape LaTeX special characters, if it is nil no
+	// replacement takes place.
+	Replace LatexEscapeFunc
+	// Modifiers are the supported modifiers, see ExpandModifier.
+	Modifiers map[string]ExpandModifier
+	// Newlines describes how line breaks in values are handled.
+	Newlines NewlinePolicy
+	// PlaceholderNewlines overrides Newlines for certain placeholders.
+	PlaceholderNewlines map[string]NewlinePolicy
+}
+
+// newlinePolicy returns the newline policy for a placeholder.
+func (opts *ExpandOptions) newlinePolicy(placeholder string) NewlinePolicy {
+	if policy, has := opts.PlaceholderNewlines[placeholder]; has {
+		return policy
+	}
+	return opts.Newlines
+}
+
+// expandReplacement replaces placeholders with their values.
+type expandReplacement struct {
+	replacer *strings.Replacer
+	// failed maps "placeholder|modifier" to the error of the modifier, the
+	// error is only reported if the string is used.
+	failed map[string]error
+}
+
+// newExpandReplacement returns a replacement given a mapping placeholder to
+// (unescaped) value. For each modifier an additional pair
+// "placeholder|modifier" is created. Those pairs come first, this way they take
+// precedence over the placeholder without a modifier.
+//
+// An error is returned if the newline policy rejects a value or if it can't
+// be escaped, for example because it contains a rune that can't be
+// transliterated.
+func newExpandReplacement(values map[string]string, opts *ExpandOptions) (*expandReplacement, error) {
+	pairs := make([]string, 0, 2*len(values)*(len(opts.Modifiers)+1))
+	var failed map[string]error
+	for key, value := range values {
+		for name, modifier := range opts.Modifiers {
+			modifiedKey := key + ExpandModifierSeparator + name
+			modified, err := applyModifier(modifier, value, opts.Replace)
+			if err != nil {
+				if failed == nil {
+					failed = make(map[string]error)
+				}
+				failed[modifiedKey] = fmt.Errorf("can't apply modifier \"%s\" to placeholder \"%s\": %v", name, key, err)
+				continue
+			}
+			pairs = append(pairs, modifiedKey, modified)
+		}
+	}
+	for key, value := range values {
+		value, err := EscapeErr(opts.Replace, value)
+		if err == nil {
+			value, err = opts.newlinePolicy(key).Apply(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for placeholder \"%s\": %v", key, err)
+		}
+		pairs = append(pairs, key, value)
+	}
+	return &expandReplacement{strings.NewReplacer(pairs...), failed}, nil
+}
+
+// applyModifier applies modifier to value, a UnicodeError from replace is
+// returned as error.
+func applyModifier(modifier ExpandModifier, value string, replace LatexEscapeFunc) (res string, err error) {
+	defer recoverUnicodeError(&err)
+	return modifier(value, replace)
+}
+
+// replace replaces all placeholders in line. It returns an error if line
+// contains a placeholder with a modifier that failed.
+func (r *expandReplacement) replace(line string) (string, error) {
+	for key, err := range r.failed {
+		if strings.Contains(line, key) {
+			return "", err
+		}
+	}
+	return r.replacer.Replace(line), nil
 }
 
 // ConstHandler replaces place holders with constant values.
 type ConstHandler struct {
-	replacer *strings.Replacer
+	replacement *expandReplacement
 }
 
 // NewConstHandler returns a new ConstHandler give the mapping place holder
@@ -91,11 +258,43 @@ func NewConstHandler(mapper map[string]string, replaceFunc LatexEscapeFunc) *Con
 		}
 		replaceMap = append(replaceMap, key, valueStr)
 	}
-	return &ConstHandler{strings.NewReplacer(replaceMap...)}
+	return &ConstHandler{&expandReplacement{strings.NewReplacer(replaceMap...), nil}}
 }
 
+// NewModifierConstHandler works as NewConstHandler but supports modifiers:
+// For a placeholder "NAME" and a modifier "math" the string "NAME|math" is
+// replaced by the value after applying the modifier.
+// If a modifier fails for a value the error is reported by HandleLineErr
+// once "NAME|math" is used.
+func NewModifierConstHandler(mapper map[string]string, replaceFunc LatexEscapeFunc, modifiers map[string]ExpandModifier) (*ConstHandler, error) {
+	return NewConstHandlerWithOptions(mapper, &ExpandOptions{Replace: replaceFunc, Modifiers: modifiers})
+}
+
+// NewConstHandlerWithOptions works as NewModifierConstHandler but is
+// configured by opts. An error is returned if a value is rejected by the
+// newline policy.
+func NewConstHandlerWithOptions(mapper map[string]string, opts *ExpandOptions) (*ConstHandler, error) {
+	replacement, err := newExpandReplacement(mapper, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &ConstHandler{replacement}, nil
+}
+
+// HandleLine replaces all placeholders in line. It panics if a placeholder
+// with a modifier that failed is used, see HandleLineErr.
 func (h *ConstHandler) HandleLine(line string) string {
-	return h.replacer.Replace(line)
+	res, err := h.HandleLineErr(line)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+// HandleLineErr works as HandleLine but returns an error if a placeholder
+// with a modifier that failed is used.
+func (h *ConstHandler) HandleLineErr(line string) (string, error) {
+	return h.replacement.replace(line)
 }
 
 // RowHandler replaces placeholders with values from a given column. It is not
@@ -104,44 +303,92 @@ func (h *ConstHandler) HandleLine(line string) string {
 // concurrently. WithColumn must be called before using HandleLine.
 type RowHandler struct {
 	replaceVarMap map[string]string
-	replaceFunc   LatexEscapeFunc
+	opts          *ExpandOptions
 	currentCol    *Column
+	replacement   *expandReplacement
 }
 
 // NewRowHandler returns a new RowHandler. replaceVarMap must be a mapping
 // mapping replace names to row names, for example "REPL-TOKEN" --> "token".
 // WithColumn must be called before HandleLine can be used.
 func NewRowHandler(replaceVarMap map[string]string, replaceFunc LatexEscapeFunc) *RowHandler {
-	return &RowHandler{replaceVarMap, replaceFunc, nil}
+	return NewRowHandlerWithOptions(replaceVarMap, &ExpandOptions{Replace: replaceFunc})
+}
+
+// NewModifierRowHandler works as NewRowHandler but supports modifiers, see
+// NewModifierConstHandler.
+func NewModifierRowHandler(replaceVarMap map[string]string, replaceFunc LatexEscapeFunc, modifiers map[string]ExpandModifier) *RowHandler {
+	return NewRowHandlerWithOptions(replaceVarMap, &ExpandOptions{Replace: replaceFunc, Modifiers: modifiers})
+}
+
+// NewRowHandlerWithOptions works as NewModifierRowHandler but is configured by
+// opts. Note that the placeholders in opts.PlaceholderNewlines are replace
+// names, not row names. Use ForColumn to check that the values of a column
+// are accepted by the newline policy.
+func NewRowHandlerWithOptions(replaceVarMap map[string]string, opts *ExpandOptions) *RowHandler {
+	return &RowHandler{replaceVarMap, opts, nil, nil}
 }
 
 // WithColumn returns a new row handler with the column set.
 func (h *RowHandler) WithColumn(c *Column) *RowHandler {
-	return &RowHandler{h.replaceVarMap, h.replaceFunc, c}
+	return &RowHandler{h.replaceVarMap, h.opts, c, nil}
+}
+
+// ForColumn works as WithColumn but computes all replacements immediately.
+// It returns an error if a value from the column is rejected by the newline
+// policy.
+func (h *RowHandler) ForColumn(c *Column) (*RowHandler, error) {
+	res := h.WithColumn(c)
+	replacement, err := res.columnReplacement()
+	if err != nil {
+		return nil, err
+	}
+	res.replacement = replacement
+	return res, nil
+}
+
+// columnReplacement returns the replacement for the current column.
+func (h *RowHandler) columnReplacement() (*expandReplacement, error) {
+	values := make(map[string]string, len(h.replaceVarMap))
+	for replName, rowName := range h.replaceVarMap {
+		// lookup in colMap
+		values[replName] = h.currentCol.GetKey(rowName)
+	}
+	return newExpandReplacement(values, h.opts)
 }
 
 // HandleLine applies the actual replacement by substituting values for the current column.
 // If the current column is nil this method panics, a column must be set before with WithColumn.
+// It also panics in all cases where HandleLineErr returns an error.
 func (h *RowHandler) HandleLine(line string) string {
+	res, err := h.HandleLineErr(line)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+// HandleLineErr works as HandleLine but returns an error if a value is
+// rejected by the newline policy or if a placeholder with a modifier that
+// failed is used.
+func (h *RowHandler) HandleLineErr(line string) (string, error) {
 	if h.currentCol == nil {
 		panic("no column set, WithColumn must be called before using RowHandler")
 	}
 	// fast: if no variables are given that need replacing return line
 	if len(h.replaceVarMap) == 0 {
-		return line
+		return line, nil
 	}
-	// now create a replace and get each value from colMap
-	replaceMap := make([]string, 0, len(h.replaceVarMap)*2)
-	for replName, rowName := range h.replaceVarMap {
-		// lookup in colMap, apply replace func if given
-		val := h.currentCol.GetKey(rowName)
-		if h.replaceFunc != nil {
-			val = h.replaceFunc(val)
+	replacement := h.replacement
+	if replacement == nil {
+		// now create a replacement from the values of the column
+		var err error
+		replacement, err = h.columnReplacement()
+		if err != nil {
+			return "", err
 		}
-		replaceMap = append(replaceMap, replName, val)
 	}
-	replacer := strings.NewReplacer(replaceMap...)
-	return replacer.Replace(line)
+	return replacement.replace(line)
 }
 
 type expandParseState int
@@ -232,3 +479,74 @@ func ExpandConfigFromJSONFile(file string) (map[string]string, map[string]string
 	consts, rows, err = ExpandConfigJSON(f)
 	return consts, rows, err
 }
+
+// ExpandConfigYAML works as ExpandConfigJSON but parses YAML.
+func ExpandConfigYAML(r io.Reader) (map[string]string, map[string]string, error) {
+	type fileContent struct {
+		Const map[string]string `yaml:"const"`
+		Rows  map[string]string `yaml:"rows"`
+	}
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	inst := fileContent{
+		make(map[string]string),
+		make(map[string]string),
+	}
+	if err := dec.Decode(&inst); err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	return inst.Const, inst.Rows, nil
+}
+
+// ExpandConfigTOML works as ExpandConfigJSON but parses TOML, the variables
+// are given in the tables [const] and [rows].
+func ExpandConfigTOML(r io.Reader) (map[string]string, map[string]string, error) {
+	type fileContent struct {
+		Const map[string]interface{} `toml:"const"`
+		Rows  map[string]interface{} `toml:"rows"`
+	}
+	var inst fileContent
+	meta, err := toml.NewDecoder(r).Decode(&inst)
+	if err != nil {
+		return nil, nil, err
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return nil, nil, fmt.Errorf("unknown key \"%s\" in config", undecoded[0])
+	}
+	consts, err := stringValues(inst.Const)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := stringValues(inst.Rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	return consts, rows, nil
+}
+
+// ExpandConfigFromFile reads a config file. Files ending in ".yaml" or ".yml"
+// are parsed with ExpandConfigYAML, files ending in ".toml" with
+// ExpandConfigTOML and all other files with ExpandConfigJSON.
+func ExpandConfigFromFile(file string) (map[string]string, map[string]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	var consts, rows map[string]string
+	defer func() {
+		closeErr := f.Close()
+		if err == nil && closeErr != nil {
+			consts, rows = nil, nil
+			err = closeErr
+		}
+	}()
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		consts, rows, err = ExpandConfigYAML(f)
+	case ".toml":
+		consts, rows, err = ExpandConfigTOML(f)
+	default:
+		consts, rows, err = ExpandConfigJSON(f)
+	}
+	return consts, rows, err
+}
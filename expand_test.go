@@ -0,0 +1,117 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// configValues contains the same values in yaml and toml, both formats must
+// produce the same strings.
+var configValues = []struct {
+	yaml, toml, expected string
+}{
+	{`"foo"`, `"foo"`, "foo"},
+	{"42", "42", "42"},
+	{"-7", "-7", "-7"},
+	{"1.5", "1.5", "1.5"},
+	{"0.1", "0.1", "0.1"},
+	{"1234567.25", "1234567.25", "1234567.25"},
+	{"true", "true", "true"},
+	{"2024-03-01", "2024-03-01", "2024-03-01"},
+	{"07:32:00", "07:32:00", "07:32:00"},
+	{"2024-03-01T07:32:00", "2024-03-01T07:32:00", "2024-03-01T07:32:00"},
+	{"2024-03-01T00:00:00Z", "2024-03-01T00:00:00Z", "2024-03-01T00:00:00Z"},
+	{"2024-03-01T07:32:00+01:00", "2024-03-01T07:32:00+01:00", "2024-03-01T07:32:00+01:00"},
+}
+
+func TestExpandConfigFormats(t *testing.T) {
+	var yamlConfig, tomlConfig strings.Builder
+	yamlConfig.WriteString("const:\n")
+	tomlConfig.WriteString("[const]\n")
+	expected := make(map[string]string, len(configValues))
+	for i, value := range configValues {
+		key := "V" + string(rune('a'+i))
+		yamlConfig.WriteString("  " + key + ": " + value.yaml + "\n")
+		tomlConfig.WriteString(key + " = " + value.toml + "\n")
+		expected[key] = value.expected
+	}
+	yamlConfig.WriteString("rows:\n")
+	tomlConfig.WriteString("[rows]\n")
+	for i, value := range configValues {
+		key := "R" + string(rune('a'+i))
+		yamlConfig.WriteString("  " + key + ": " + value.yaml + "\n")
+		tomlConfig.WriteString(key + " = " + value.toml + "\n")
+	}
+	yamlConsts, yamlRows, err := ExpandConfigYAML(strings.NewReader(yamlConfig.String()))
+	if err != nil {
+		t.Fatalf("yaml: unexpected error: %v", err)
+	}
+	tomlConsts, tomlRows, err := ExpandConfigTOML(strings.NewReader(tomlConfig.String()))
+	if err != nil {
+		t.Fatalf("toml: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(yamlConsts, expected) {
+		t.Errorf("yaml: expected %v, got %v", expected, yamlConsts)
+	}
+	if !reflect.DeepEqual(tomlConsts, yamlConsts) {
+		t.Errorf("toml const: expected %v, got %v", yamlConsts, tomlConsts)
+	}
+	if !reflect.DeepEqual(tomlRows, yamlRows) || len(tomlRows) != len(configValues) {
+		t.Errorf("toml rows: expected %v, got %v", yamlRows, tomlRows)
+	}
+}
+
+func TestTemplateConstFormats(t *testing.T) {
+	var yamlConsts, tomlConsts strings.Builder
+	expected := make(map[string]string, len(configValues))
+	for i, value := range configValues {
+		key := "V" + string(rune('a'+i))
+		yamlConsts.WriteString(key + ": " + value.yaml + "\n")
+		tomlConsts.WriteString(key + " = " + value.toml + "\n")
+		expected[key] = value.expected
+	}
+	fromYAML, err := TemplateConstYAML(strings.NewReader(yamlConsts.String()))
+	if err != nil {
+		t.Fatalf("yaml: unexpected error: %v", err)
+	}
+	fromTOML, err := TemplateConstTOML(strings.NewReader(tomlConsts.String()))
+	if err != nil {
+		t.Fatalf("toml: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(fromYAML, expected) {
+		t.Errorf("yaml: expected %v, got %v", expected, fromYAML)
+	}
+	if !reflect.DeepEqual(fromTOML, expected) {
+		t.Errorf("toml: expected %v, got %v", expected, fromTOML)
+	}
+}
+
+func TestExpandConfigErrors(t *testing.T) {
+	for _, config := range []string{
+		"[const]\nA = [1, 2]\n",
+		"[rows]\nA = { b = 1 }\n",
+		"[other]\nA = 1\n",
+	} {
+		if _, _, err := ExpandConfigTOML(strings.NewReader(config)); err == nil {
+			t.Errorf("%q: expected an error", config)
+		}
+	}
+	if _, _, err := ExpandConfigYAML(strings.NewReader("other:\n  A: 1\n")); err == nil {
+		t.Error("yaml: expected an error for an unknown key")
+	}
+}
@@ -14,6 +14,12 @@
 
 package gummibaum
 
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
 // IntMin returns the minimum of a and b.
 func IntMin(a, b int) int {
 	if a < b {
@@ -22,6 +28,14 @@ func IntMin(a, b int) int {
 	return b
 }
 
+// IntMax returns the maximum of a and b.
+func IntMax(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
 // MergeStringMaps combines two string maps. The result is a new map (both maps are
 // unchanged) containing all entries from m1 and m2. If a key is present in both maps
 // the value from m2 is used.
@@ -35,3 +49,38 @@ func MergeStringMaps(m1, m2 map[string]string) map[string]string {
 	}
 	return res
 }
+
+// tomlLocalLayouts maps the names of the locations that the toml package uses
+// for local dates and times to the layout that formats them as written.
+var tomlLocalLayouts = map[string]string{
+	"date-local":     "2006-01-02",
+	"time-local":     "15:04:05.999999999",
+	"datetime-local": "2006-01-02T15:04:05.999999999",
+}
+
+// stringValues converts the values of m (from a toml file) to strings.
+// Only scalar values (strings, numbers, booleans and dates) are allowed.
+func stringValues(m map[string]interface{}) (map[string]string, error) {
+	res := make(map[string]string, len(m))
+	for key, value := range m {
+		switch v := value.(type) {
+		case string:
+			res[key] = v
+		case nil:
+			res[key] = ""
+		case time.Time:
+			if layout, local := tomlLocalLayouts[v.Location().String()]; local {
+				res[key] = v.Format(layout)
+			} else {
+				res[key] = v.Format(time.RFC3339Nano)
+			}
+		case float64:
+			res[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool, int, int64, uint64:
+			res[key] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("value of \"%s\" must be a string, number, boolean or date", key)
+		}
+	}
+	return res, nil
+}
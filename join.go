@@ -0,0 +1,181 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lookup returns the first column whose entry with the given row name equals
+// value (surrounding whitespace is ignored). It returns nil if there is no
+// such column.
+func (c *Collection) Lookup(key, value string) (*Column, error) {
+	if !c.hasKey(key) {
+		return nil, NewColKeyError("invalid key: %s, allowed keys are %s", key, strings.Join(c.Head, ", "))
+	}
+	value = strings.TrimSpace(value)
+	for _, col := range c.Columns {
+		if entry := col.GetKey(key); entry != NoColEntry && strings.TrimSpace(entry) == value {
+			return col, nil
+		}
+	}
+	return nil, nil
+}
+
+// LookupFunc is the template function "lookup", it calls Collection.Lookup.
+// The arguments are the row name, the value and a collection, group or chunk.
+// The result is nil if no column is found, so it should be used with "with".
+// Example: #(with lookup "id" .Map.customer .customers#)#(.Map.address#)#(end#).
+func LookupFunc(args ...interface{}) (*Column, error) {
+	strs, c, err := collectionArgs("lookup", args)
+	if err != nil {
+		return nil, err
+	}
+	if len(strs) != 2 {
+		return nil, fmt.Errorf("lookup expects 3 arguments, got %d", len(args))
+	}
+	return c.Lookup(strs[0], strs[1])
+}
+
+// JoinKind describes how columns without a match are handled by Join.
+type JoinKind int
+
+const (
+	// InnerJoin only contains columns with a match.
+	InnerJoin JoinKind = iota
+	// LeftJoin contains all columns from the left collection, the entries from
+	// the right collection are empty if there is no match.
+	LeftJoin
+)
+
+func (kind JoinKind) String() string {
+	switch kind {
+	case InnerJoin:
+		return "inner"
+	case LeftJoin:
+		return "left"
+	default:
+		return fmt.Sprintf("JoinKind(%d)", int(kind))
+	}
+}
+
+// Join combines the columns of c and other: Each column of c is combined with
+// each column of other where the entry leftKey of c equals the entry rightKey
+// of other (surrounding whitespace is ignored). The head of the result
+// consists of the head of c with leftPrefix and the head of other with
+// rightPrefix. If both prefixes are empty row names of other that already
+// exist in c are omitted, so the entries of c are kept. Otherwise an error is
+// returned if the prefixes result in duplicate names.
+// Example: orders.Join(customers, InnerJoin, "customer", "id", "", "customer_")
+// has the row names of orders and customer_id, customer_address etc.
+func (c *Collection) Join(other *Collection, kind JoinKind, leftKey, rightKey, leftPrefix, rightPrefix string) (*Collection, error) {
+	if !c.hasKey(leftKey) {
+		return nil, NewColKeyError("invalid key: %s, allowed keys are %s", leftKey, strings.Join(c.Head, ", "))
+	}
+	if !other.hasKey(rightKey) {
+		return nil, NewColKeyError("invalid key: %s, allowed keys are %s", rightKey, strings.Join(other.Head, ", "))
+	}
+	keepLeft := leftPrefix == "" && rightPrefix == ""
+	head := make([]string, 0, len(c.Head)+len(other.Head))
+	names := make(map[string]struct{}, cap(head))
+	// rightPositions are the positions of the row names of other in the result
+	rightPositions := make([]int, 0, len(other.Head))
+	for _, part := range []struct {
+		head   []string
+		prefix string
+		right  bool
+	}{{c.Head, leftPrefix, false}, {other.Head, rightPrefix, true}} {
+		for i, h := range part.head {
+			name := part.prefix + h
+			if _, has := names[name]; has {
+				if part.right && keepLeft {
+					continue
+				}
+				return nil, fmt.Errorf("duplicate row name \"%s\" in join, use a prefix", name)
+			}
+			names[name] = struct{}{}
+			head = append(head, name)
+			if part.right {
+				rightPositions = append(rightPositions, i)
+			}
+		}
+	}
+	// index the right collection
+	index := make(map[string][]*Column, len(other.Columns))
+	for _, col := range other.Columns {
+		if entry := col.GetKey(rightKey); entry != NoColEntry {
+			id := strings.TrimSpace(entry)
+			index[id] = append(index[id], col)
+		}
+	}
+	var cols []*Column
+	for _, col := range c.Columns {
+		left := make([]string, len(c.Head))
+		copy(left, col.Entries)
+		matches := index[strings.TrimSpace(col.GetKey(leftKey))]
+		if len(matches) == 0 && kind == LeftJoin {
+			cols = append(cols, NewColumn(head, append(left, make([]string, len(rightPositions))...)))
+		}
+		for _, match := range matches {
+			joined := make([]string, len(left), len(head))
+			copy(joined, left)
+			for _, i := range rightPositions {
+				entry := ""
+				if i < len(match.Entries) {
+					entry = match.Entries[i]
+				}
+				joined = append(joined, entry)
+			}
+			cols = append(cols, NewColumn(head, joined))
+		}
+	}
+	return &Collection{head, cols}, nil
+}
+
+// joinFunc returns the template function for the given join kind. The
+// arguments are the left collection, the left key, the right collection, the
+// right key and optionally the left and right prefix. Collections can also be
+// groups or chunks.
+func joinFunc(name string, kind JoinKind) func(left interface{}, leftKey string, right interface{}, rightKey string, prefixes ...string) (*Collection, error) {
+	return func(left interface{}, leftKey string, right interface{}, rightKey string, prefixes ...string) (*Collection, error) {
+		var leftPrefix, rightPrefix string
+		switch len(prefixes) {
+		case 0:
+		case 2:
+			leftPrefix, rightPrefix = prefixes[0], prefixes[1]
+		default:
+			return nil, fmt.Errorf("%s expects 4 or 6 arguments, got %d", name, len(prefixes)+4)
+		}
+		l, ok := toCollection(left)
+		if !ok {
+			return nil, fmt.Errorf("%s expects a collection as first argument, got %T", name, left)
+		}
+		r, ok := toCollection(right)
+		if !ok {
+			return nil, fmt.Errorf("%s expects a collection as third argument, got %T", name, right)
+		}
+		return l.Join(r, kind, leftKey, rightKey, leftPrefix, rightPrefix)
+	}
+}
+
+// InnerJoinFunc is the template function "innerJoin", see Collection.Join.
+// Without prefixes row names of the right collection that also exist in the
+// left collection are omitted.
+// Example: #(range (innerJoin .orders "customer" .customers "id" "" "c_").Columns#)...#(end#).
+var InnerJoinFunc = joinFunc("innerJoin", InnerJoin)
+
+// LeftJoinFunc is the template function "leftJoin", see InnerJoinFunc.
+var LeftJoinFunc = joinFunc("leftJoin", LeftJoin)
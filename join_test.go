@@ -0,0 +1,96 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"reflect"
+	"testing"
+)
+
+func joinTestData(t *testing.T) map[string]interface{} {
+	orders := testCollection(t, []string{"id", "customer", "total"},
+		[]string{"1", "10", "5"},
+		[]string{"2", "11", "7"},
+		[]string{"3", "12", "9"},
+		[]string{"4", " 10 ", "1"},
+	)
+	customers := testCollection(t, []string{"id", "name"},
+		[]string{"10", "Alice"},
+		[]string{"11", "Bob"},
+	)
+	return map[string]interface{}{"orders": orders, "customers": customers}
+}
+
+func TestJoin(t *testing.T) {
+	data := joinTestData(t)
+	orders, customers := data["orders"].(*Collection), data["customers"].(*Collection)
+	joined, err := orders.Join(customers, InnerJoin, "customer", "id", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"id", "customer", "total", "name"}; !reflect.DeepEqual(joined.Head, expected) {
+		t.Errorf("expected head %v, got %v", expected, joined.Head)
+	}
+	if len(joined.Columns) != 3 || joined.Columns[0].Map["id"] != "1" || joined.Columns[2].Map["name"] != "Alice" {
+		t.Errorf("unexpected join result %v", joined.Columns)
+	}
+	left, err := orders.Join(customers, LeftJoin, "customer", "id", "o_", "c_")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"o_id", "o_customer", "o_total", "c_id", "c_name"}; !reflect.DeepEqual(left.Head, expected) {
+		t.Errorf("expected head %v, got %v", expected, left.Head)
+	}
+	if len(left.Columns) != 4 || left.Columns[2].Map["c_name"] != "" || left.Columns[3].Map["c_id"] != "10" {
+		t.Errorf("unexpected join result %v", left.Columns)
+	}
+	if _, err := orders.Join(customers, InnerJoin, "customer", "id", "x_", "x_"); err == nil {
+		t.Error("expected an error for duplicate row names")
+	}
+}
+
+func TestJoinFuncs(t *testing.T) {
+	data := joinTestData(t)
+	tests := []struct {
+		name, template, expected string
+	}{
+		{"lookup", `#(with lookup "id" "11" .customers#)#(.Map.name#)#(end#)`, "Bob"},
+		{"lookup missing", `#(with lookup "id" "12" .customers#)#(.Map.name#)#(else#)none#(end#)`, "none"},
+		{"innerJoin", `#(range (innerJoin .orders "customer" .customers "id").Columns#)#(.Map.id#):#(.Map.name#);#(end#)`, "1:Alice;2:Bob;4:Alice;"},
+		{"leftJoin prefixes", `#(range (leftJoin .orders "customer" .customers "id" "" "c_").Columns#)#(.Map.c_name#);#(end#)`, "Alice;Bob;;Alice;"},
+		{"join group", `#(range groupBy "name" (innerJoin .orders "customer" .customers "id")#)#(.Name#)=#(sum "total" .#);#(end#)`, "Alice=6;Bob=7;"},
+		{"lookup in group", `#(range groupBy "id" .customers#)#(with lookup "id" "10" .#)#(.Map.name#)#(end#)#(end#)`, "Alice"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := executeTemplate(&TemplateOptions{}, data, test.template)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+	for _, template := range []string{
+		`#(innerJoin .orders "customer" .customers "id" "c_"#)`,
+		`#(innerJoin "orders" "customer" .customers "id"#)`,
+		`#(lookup "id" .customers#)`,
+	} {
+		if got, err := executeTemplate(&TemplateOptions{}, data, template); err == nil {
+			t.Errorf("%s: expected an error, got %q", template, got)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// DefaultJSONSeparator is the separator used to flatten nested objects.
+const DefaultJSONSeparator = "."
+
+// JSONReader implements CollectionSource by reading a json array of objects.
+type JSONReader struct {
+	HeadContent    []string
+	ColumnsContent [][]string
+}
+
+// jsonField is a flattened entry of a json object.
+type jsonField struct {
+	key, value string
+}
+
+// NewJSONReader returns a new json reader given the reader source. The content
+// must be an array of objects, each object is a column.
+//
+// The head is the union of the keys of all objects in the order of their first
+// occurrence. Nested objects are flattened: The keys are joined with sep, for
+// example {"address": {"city": "Berlin"}} becomes "address.city" for sep ".".
+// Arrays are flattened the same way with the index as key ("tags.0"). Numbers
+// are written as in the input, booleans as true / false, null and missing keys
+// as empty string.
+//
+// This function exhaustively reads all data from the reader in memory.
+func NewJSONReader(r io.Reader, sep string) (*JSONReader, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := expectJSONDelim(dec, '['); err != nil {
+		return nil, err
+	}
+	var objects [][]jsonField
+	for dec.More() {
+		if err := expectJSONDelim(dec, '{'); err != nil {
+			return nil, fmt.Errorf("json data must be an array of objects: %w", err)
+		}
+		fields, err := readJSONObject(dec, "", sep, nil)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, fields)
+	}
+	if err := expectJSONDelim(dec, ']'); err != nil {
+		return nil, err
+	}
+	// compute the union of all keys
+	positions := make(map[string]int)
+	var head []string
+	for _, fields := range objects {
+		for _, field := range fields {
+			if _, has := positions[field.key]; !has {
+				positions[field.key] = len(head)
+				head = append(head, field.key)
+			}
+		}
+	}
+	columns := make([][]string, len(objects))
+	for i, fields := range objects {
+		col := make([]string, len(head))
+		for _, field := range fields {
+			col[positions[field.key]] = field.value
+		}
+		columns[i] = col
+	}
+	return &JSONReader{
+			HeadContent:    head,
+			ColumnsContent: columns,
+		},
+		nil
+}
+
+// NewJSONFileReader returns a new json reader given a file path.
+func NewJSONFileReader(file string, sep string) (*JSONReader, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	var reader *JSONReader
+	defer func() {
+		closeErr := f.Close()
+		if err == nil && closeErr != nil {
+			reader = nil
+			err = closeErr
+		}
+	}()
+	reader, err = NewJSONReader(f, sep)
+	return reader, err
+}
+
+// expectJSONDelim reads the next token and returns an error if it is not the
+// given delimiter.
+func expectJSONDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := token.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("invalid json: expected %s, got %v", delim, token)
+	}
+	return nil
+}
+
+// readJSONObject reads the entries of an object (the opening brace has already
+// been read) and appends them to fields.
+func readJSONObject(dec *json.Decoder, prefix, sep string, fields []jsonField) ([]jsonField, error) {
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid json: expected object key, got %v", token)
+		}
+		if fields, err = readJSONValue(dec, prefix+key, sep, fields); err != nil {
+			return nil, err
+		}
+	}
+	// read closing brace
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// readJSONValue reads the next value with the given key and appends it to
+// fields, nested objects and arrays are flattened.
+func readJSONValue(dec *json.Decoder, key, sep string, fields []jsonField) ([]jsonField, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := token.(type) {
+	case json.Delim:
+		switch v {
+		case '{':
+			return readJSONObject(dec, key+sep, sep, fields)
+		case '[':
+			for i := 0; dec.More(); i++ {
+				if fields, err = readJSONValue(dec, key+sep+strconv.Itoa(i), sep, fields); err != nil {
+					return nil, err
+				}
+			}
+			// read closing bracket
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return fields, nil
+		default:
+			return nil, errors.New("invalid json: unexpected delimiter")
+		}
+	case string:
+		return append(fields, jsonField{key, v}), nil
+	case json.Number:
+		return append(fields, jsonField{key, v.String()}), nil
+	case bool:
+		return append(fields, jsonField{key, strconv.FormatBool(v)}), nil
+	case nil:
+		return append(fields, jsonField{key, ""}), nil
+	default:
+		return nil, fmt.Errorf("invalid json: unexpected token %v", token)
+	}
+}
+
+// Head returns the head.
+func (r *JSONReader) Head() ([]string, error) {
+	return r.HeadContent, nil
+}
+
+// Entries returns all columns.
+func (r *JSONReader) Entries() ([][]string, error) {
+	return r.ColumnsContent, nil
+}
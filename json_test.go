@@ -0,0 +1,112 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewJSONReader(t *testing.T) {
+	tests := []struct {
+		name, json, sep string
+		head            []string
+		columns         [][]string
+	}{
+		{
+			"flat",
+			`[{"name": "a", "price": 1.50}, {"name": "b", "price": 2}]`, ".",
+			[]string{"name", "price"},
+			[][]string{{"a", "1.50"}, {"b", "2"}},
+		},
+		{
+			"union of keys",
+			`[{"a": "1"}, {"b": "2", "a": "3"}, {"c": "4"}]`, ".",
+			[]string{"a", "b", "c"},
+			[][]string{{"1", "", ""}, {"3", "2", ""}, {"", "", "4"}},
+		},
+		{
+			"scalars",
+			`[{"t": true, "f": false, "n": null, "big": 12345678901234567890, "e": 1e3}]`, ".",
+			[]string{"t", "f", "n", "big", "e"},
+			[][]string{{"true", "false", "", "12345678901234567890", "1e3"}},
+		},
+		{
+			"nested",
+			`[{"address": {"city": "Berlin", "geo": {"lat": 52.5}}, "tags": ["x", {"y": 1}]}]`, ".",
+			[]string{"address.city", "address.geo.lat", "tags.0", "tags.1.y"},
+			[][]string{{"Berlin", "52.5", "x", "1"}},
+		},
+		{
+			"separator",
+			`[{"address": {"city": "Berlin"}}]`, "_",
+			[]string{"address_city"},
+			[][]string{{"Berlin"}},
+		},
+		{"empty", `[]`, ".", nil, [][]string{}},
+		{"empty object", `[{}]`, ".", nil, [][]string{{}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := NewJSONReader(strings.NewReader(test.json), test.sep)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			head, _ := r.Head()
+			columns, _ := r.Entries()
+			if !reflect.DeepEqual(head, test.head) {
+				t.Errorf("expected head %q, got %q", test.head, head)
+			}
+			if !reflect.DeepEqual(columns, test.columns) {
+				t.Errorf("expected columns %q, got %q", test.columns, columns)
+			}
+		})
+	}
+	for _, json := range []string{``, `{}`, `[1]`, `[{"a": 1}, "b"]`, `[{"a": 1}`, `[{"a": }]`, `[{"a": [1}]`} {
+		if _, err := NewJSONReader(strings.NewReader(json), "."); err == nil {
+			t.Errorf("%q: expected an error", json)
+		}
+	}
+}
+
+func TestJSONCollection(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "products.json")
+	content := `[{"name": "a_b", "price": "1.5", "stock": {"count": 3}}, {"name": "c", "price": 2.25}]`
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatalf("can't write file: %v", err)
+	}
+	r, err := NewJSONFileReader(file, DefaultJSONSeparator)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c, err := NewCollection(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := executeTemplate(autoEscapeOptions(), map[string]interface{}{"data": c},
+		`#(range .data.Columns#)#(.Get "name"#):#(.Get "stock.count"#);#(end#) #(sum "price" .data#)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := `a\_b:3;c:; 3.75`; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if _, err := NewJSONFileReader(filepath.Join(t.TempDir(), "missing.json"), "."); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
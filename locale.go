@@ -0,0 +1,200 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Locale describes how values are formatted for a certain language / region.
+// All strings are LaTeX code.
+type Locale struct {
+	// Name is the name of the locale, for example "de-DE".
+	Name string
+	// Decimal is the decimal separator.
+	Decimal string
+	// Thousands is the separator between groups of three digits.
+	Thousands string
+	// Percent is appended to percentages, it includes the space between the
+	// number and the sign.
+	Percent string
+	// Months contains the names of the months, starting with January.
+	Months [12]string
+	// ShortMonths contains the abbreviated names of the months.
+	ShortMonths [12]string
+	// Days contains the names of the weekdays, starting with Sunday.
+	Days [7]string
+	// ShortDays contains the abbreviated names of the weekdays.
+	ShortDays [7]string
+	// ShortDate is the layout (see package time) for short dates.
+	ShortDate string
+	// LongDate is the layout for long dates, month names are translated.
+	LongDate string
+	// Currency is the ISO 4217 code of the default currency.
+	Currency string
+	// CurrencyBefore is true if the currency symbol is written before the
+	// amount.
+	CurrencyBefore bool
+	// CurrencySpace is written between the amount and the currency symbol.
+	CurrencySpace string
+}
+
+var (
+	englishMonths = [12]string{"January", "February", "March", "April", "May", "June",
+		"July", "August", "September", "October", "November", "December"}
+	englishShortMonths = [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun",
+		"Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+	englishDays      = [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+	englishShortDays = [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+	germanMonths = [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni",
+		"Juli", "August", "September", "Oktober", "November", "Dezember"}
+	germanShortMonths = [12]string{"Jan", "Feb", "Mär", "Apr", "Mai", "Jun",
+		"Jul", "Aug", "Sep", "Okt", "Nov", "Dez"}
+	germanDays      = [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"}
+	germanShortDays = [7]string{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"}
+
+	frenchMonths = [12]string{"janvier", "février", "mars", "avril", "mai", "juin",
+		"juillet", "août", "septembre", "octobre", "novembre", "décembre"}
+	frenchShortMonths = [12]string{"janv", "févr", "mars", "avr", "mai", "juin",
+		"juil", "août", "sept", "oct", "nov", "déc"}
+	frenchDays      = [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"}
+	frenchShortDays = [7]string{"dim", "lun", "mar", "mer", "jeu", "ven", "sam"}
+)
+
+var (
+	// EnglishLocale is the default locale.
+	EnglishLocale = &Locale{
+		Name:           "en-US",
+		Decimal:        ".",
+		Thousands:      ",",
+		Percent:        `\%`,
+		Months:         englishMonths,
+		ShortMonths:    englishShortMonths,
+		Days:           englishDays,
+		ShortDays:      englishShortDays,
+		ShortDate:      "01/02/2006",
+		LongDate:       "January 2, 2006",
+		Currency:       "USD",
+		CurrencyBefore: true,
+		CurrencySpace:  "",
+	}
+
+	// BritishLocale is the locale for the United Kingdom.
+	BritishLocale = &Locale{
+		Name:           "en-GB",
+		Decimal:        ".",
+		Thousands:      ",",
+		Percent:        `\%`,
+		Months:         englishMonths,
+		ShortMonths:    englishShortMonths,
+		Days:           englishDays,
+		ShortDays:      englishShortDays,
+		ShortDate:      "02/01/2006",
+		LongDate:       "2 January 2006",
+		Currency:       "GBP",
+		CurrencyBefore: true,
+		CurrencySpace:  "",
+	}
+
+	// GermanLocale is the locale for Germany.
+	GermanLocale = &Locale{
+		Name:           "de-DE",
+		Decimal:        ",",
+		Thousands:      ".",
+		Percent:        `\,\%`,
+		Months:         germanMonths,
+		ShortMonths:    germanShortMonths,
+		Days:           germanDays,
+		ShortDays:      germanShortDays,
+		ShortDate:      "02.01.2006",
+		LongDate:       "2. January 2006",
+		Currency:       "EUR",
+		CurrencyBefore: false,
+		CurrencySpace:  "~",
+	}
+
+	// FrenchLocale is the locale for France.
+	FrenchLocale = &Locale{
+		Name:           "fr-FR",
+		Decimal:        ",",
+		Thousands:      `\,`,
+		Percent:        `\,\%`,
+		Months:         frenchMonths,
+		ShortMonths:    frenchShortMonths,
+		Days:           frenchDays,
+		ShortDays:      frenchShortDays,
+		ShortDate:      "02/01/2006",
+		LongDate:       "2 January 2006",
+		Currency:       "EUR",
+		CurrencyBefore: false,
+		CurrencySpace:  "~",
+	}
+
+	// SwissLocale is the locale for the German speaking part of Switzerland.
+	SwissLocale = &Locale{
+		Name:           "de-CH",
+		Decimal:        ".",
+		Thousands:      "'",
+		Percent:        `\,\%`,
+		Months:         germanMonths,
+		ShortMonths:    germanShortMonths,
+		Days:           germanDays,
+		ShortDays:      germanShortDays,
+		ShortDate:      "02.01.2006",
+		LongDate:       "2. January 2006",
+		Currency:       "CHF",
+		CurrencyBefore: true,
+		CurrencySpace:  "~",
+	}
+
+	// Locales maps names of locales (lower case) to the locale. Names can be a
+	// language ("de") or a language with region ("de-de").
+	Locales = map[string]*Locale{
+		"en":    EnglishLocale,
+		"en-us": EnglishLocale,
+		"en-gb": BritishLocale,
+		"de":    GermanLocale,
+		"de-de": GermanLocale,
+		"de-at": GermanLocale,
+		"de-ch": SwissLocale,
+		"fr":    FrenchLocale,
+		"fr-fr": FrenchLocale,
+	}
+)
+
+// LookupLocale returns the locale with the given name from Locales. The name
+// is case insensitive and "_" can be used instead of "-". If the region is not
+// known the locale for the language is used, for example "en-AU" returns the
+// locale for "en".
+func LookupLocale(name string) (*Locale, error) {
+	key := strings.ReplaceAll(strings.ToLower(name), "_", "-")
+	if loc, has := Locales[key]; has {
+		return loc, nil
+	}
+	if i := strings.IndexByte(key, '-'); i > 0 {
+		if loc, has := Locales[key[:i]]; has {
+			return loc, nil
+		}
+	}
+	names := make([]string, 0, len(Locales))
+	for name := range Locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown locale \"%s\": Must be one of %s", name, strings.Join(names, ", "))
+}
@@ -0,0 +1,335 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	// bulletItem matches the start of an item in a bullet list.
+	bulletItem = regexp.MustCompile(`^\s{0,3}[-*+]\s+`)
+	// orderedItem matches the start of an item in an ordered list.
+	orderedItem = regexp.MustCompile(`^\s{0,3}\d{1,9}[.)]\s+`)
+)
+
+// markdownConverter converts a subset of Markdown to LaTeX.
+type markdownConverter struct {
+	replace LatexEscapeFunc
+}
+
+func (c *markdownConverter) escape(s string) string {
+	if c.replace == nil {
+		return s
+	}
+	return c.replace(s)
+}
+
+// MarkdownToLatex converts a subset of CommonMark to LaTeX. Supported are
+// paragraphs (separated by empty lines), bullet lists (itemize), ordered lists
+// (enumerate), *emphasis* and _emphasis_ (\emph), **strong** and __strong__
+// (\textbf), ***both*** (\emph{\textbf{...}}), `code` (\texttt), links
+// [text](url) (\href) and autolinks <url> (\url). A backslash escapes the
+// following punctuation character. A * between two digits is never an
+// emphasis, so 2*3*4 is not changed.
+//
+// All other text is escaped with replace, if replace is nil it is not changed.
+func MarkdownToLatex(md string, replace LatexEscapeFunc) string {
+	c := &markdownConverter{replace}
+	return c.blocks(md)
+}
+
+// blocks converts the block structure: paragraphs and lists.
+func (c *markdownConverter) blocks(md string) string {
+	md = strings.ReplaceAll(md, "\r\n", "\n")
+	lines := strings.Split(md, "\n")
+	var res []string
+	var paragraph []string
+	// listEnv is the environment of the current list, empty if not in a list
+	var listEnv string
+	var items []string
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			res = append(res, c.inline(strings.Join(paragraph, "\n")))
+			paragraph = nil
+		}
+	}
+	flushList := func() {
+		if listEnv == "" {
+			return
+		}
+		var b strings.Builder
+		b.WriteString(`\begin{` + listEnv + "}\n")
+		for _, item := range items {
+			b.WriteString(`\item ` + c.inline(item) + "\n")
+		}
+		b.WriteString(`\end{` + listEnv + "}")
+		res = append(res, b.String())
+		listEnv, items = "", nil
+	}
+	for _, line := range lines {
+		env := ""
+		var marker string
+		if m := bulletItem.FindString(line); m != "" {
+			env, marker = "itemize", m
+		} else if m := orderedItem.FindString(line); m != "" {
+			env, marker = "enumerate", m
+		}
+		switch {
+		case env != "":
+			flushParagraph()
+			if env != listEnv {
+				flushList()
+				listEnv = env
+			}
+			items = append(items, line[len(marker):])
+		case strings.TrimSpace(line) == "":
+			flushParagraph()
+			flushList()
+		case listEnv != "" && len(paragraph) == 0 && (line[0] == ' ' || line[0] == '\t'):
+			// continuation of a list item
+			items[len(items)-1] += "\n" + strings.TrimSpace(line)
+		default:
+			flushList()
+			paragraph = append(paragraph, strings.TrimSpace(line))
+		}
+	}
+	flushParagraph()
+	flushList()
+	return strings.Join(res, "\n\n")
+}
+
+// isMarkdownPunct returns true if r can be escaped with a backslash.
+func isMarkdownPunct(r rune) bool {
+	return r < unicode.MaxASCII && unicode.IsPunct(r) || strings.ContainsRune("$+<=>^`|~", r)
+}
+
+// delimiterRun returns the number of times r occurs in runes starting at i.
+func delimiterRun(runes []rune, i int, r rune) int {
+	n := 0
+	for i+n < len(runes) && runes[i+n] == r {
+		n++
+	}
+	return n
+}
+
+// findEmphasisEnd returns the position of the closing delimiter for an
+// emphasis that starts with n times delim before position start. It returns
+// -1 if there is no closing delimiter.
+func findEmphasisEnd(runes []rune, start int, delim rune, n int) int {
+	for j := start; j < len(runes); j++ {
+		if runes[j] == '`' {
+			// skip code spans
+			if end := findCodeEnd(runes, j); end >= 0 {
+				j = end - 1
+				continue
+			}
+		}
+		if runes[j] != delim {
+			continue
+		}
+		run := delimiterRun(runes, j, delim)
+		after := j + run
+		validRun := run == n || run > IntMax(n, 2)
+		if validRun && j > start && !unicode.IsSpace(runes[j-1]) && !betweenDigits(runes, j, run) &&
+			(delim != '_' || after == len(runes) || !isAlnum(runes[after])) {
+			return j
+		}
+		j += run - 1
+	}
+	return -1
+}
+
+// betweenDigits returns true if the delimiter run of length n at i is
+// surrounded by digits. Such a run is a multiplication (2*3) and not an
+// emphasis.
+func betweenDigits(runes []rune, i, n int) bool {
+	return i > 0 && i+n < len(runes) && unicode.IsDigit(runes[i-1]) && unicode.IsDigit(runes[i+n])
+}
+
+func isAlnum(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// findCodeEnd returns the position after the code span that starts at i or -1
+// if there is no such code span.
+func findCodeEnd(runes []rune, i int) int {
+	n := delimiterRun(runes, i, '`')
+	for j := i + n; j < len(runes); j++ {
+		if runes[j] != '`' {
+			continue
+		}
+		run := delimiterRun(runes, j, '`')
+		if run == n {
+			return j + run
+		}
+		j += run - 1
+	}
+	return -1
+}
+
+// findLink parses a link [text](url) starting at i. It returns the text, the
+// url and the position after the link, the position is -1 if there is no link.
+func findLink(runes []rune, i int) (string, string, int) {
+	depth := 0
+	textEnd := -1
+	for j := i; j < len(runes) && textEnd < 0; j++ {
+		switch runes[j] {
+		case '\\':
+			j++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				textEnd = j
+			}
+		}
+	}
+	if textEnd < 0 || textEnd+1 >= len(runes) || runes[textEnd+1] != '(' {
+		return "", "", -1
+	}
+	// the url must not contain spaces, parentheses must be balanced
+	depth = 0
+	for j := textEnd + 2; j < len(runes); j++ {
+		switch {
+		case runes[j] == '(':
+			depth++
+		case runes[j] == ')' && depth > 0:
+			depth--
+		case runes[j] == ')':
+			return string(runes[i+1 : textEnd]), string(runes[textEnd+2 : j]), j + 1
+		case unicode.IsSpace(runes[j]):
+			return "", "", -1
+		}
+	}
+	return "", "", -1
+}
+
+// inline converts inline markup.
+func (c *markdownConverter) inline(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	var text []rune
+	flush := func() {
+		b.WriteString(c.escape(string(text)))
+		text = text[:0]
+	}
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes) && isMarkdownPunct(runes[i+1]):
+			text = append(text, runes[i+1])
+			i++
+		case r == '`':
+			end := findCodeEnd(runes, i)
+			if end < 0 {
+				run := delimiterRun(runes, i, '`')
+				text = append(text, runes[i:i+run]...)
+				i += run - 1
+				continue
+			}
+			n := delimiterRun(runes, i, '`')
+			code := strings.TrimSpace(string(runes[i+n : end-n]))
+			flush()
+			b.WriteString(`\texttt{` + c.escape(code) + `}`)
+			i = end - 1
+		case r == '*' || r == '_':
+			run := delimiterRun(runes, i, r)
+			canOpen := i+run < len(runes) && !unicode.IsSpace(runes[i+run]) &&
+				(r != '_' || i == 0 || !isAlnum(runes[i-1])) &&
+				(r != '*' || !betweenDigits(runes, i, run))
+			// try ***, ** and * (the end of the run opens the emphasis)
+			end, n := -1, IntMin(run, 3)
+			for ; canOpen && n > 0 && end < 0; n-- {
+				end = findEmphasisEnd(runes, i+run, r, n)
+			}
+			if end < 0 {
+				text = append(text, runes[i:i+run]...)
+				i += run - 1
+				continue
+			}
+			n++
+			text = append(text, runes[i:i+run-n]...)
+			flush()
+			inner := c.inline(string(runes[i+run : end]))
+			switch n {
+			case 1:
+				b.WriteString(`\emph{` + inner + "}")
+			case 2:
+				b.WriteString(`\textbf{` + inner + "}")
+			default:
+				b.WriteString(`\emph{\textbf{` + inner + "}}")
+			}
+			i = end + n - 1
+		case r == '[':
+			linkText, url, end := findLink(runes, i)
+			if end < 0 {
+				text = append(text, r)
+				continue
+			}
+			escapedURL, err := EscapeURL(url)
+			if err != nil {
+				text = append(text, r)
+				continue
+			}
+			flush()
+			b.WriteString(`\href{` + escapedURL + `}{` + c.inline(linkText) + `}`)
+			i = end - 1
+		case r == '<':
+			end := -1
+			for j := i + 1; j < len(runes); j++ {
+				if runes[j] == '>' {
+					end = j
+					break
+				}
+				if unicode.IsSpace(runes[j]) || runes[j] == '<' {
+					break
+				}
+			}
+			url := ""
+			if end > 0 {
+				url = string(runes[i+1 : end])
+			}
+			escapedURL, err := EscapeURL(url)
+			if end < 0 || err != nil || !strings.Contains(url, ":") {
+				text = append(text, r)
+				continue
+			}
+			flush()
+			b.WriteString(`\url{` + escapedURL + `}`)
+			i = end
+		default:
+			text = append(text, r)
+		}
+	}
+	flush()
+	return b.String()
+}
+
+// Markdown returns a function for templates that converts the concatenation
+// of args with MarkdownToLatex.
+func Markdown(replace LatexEscapeFunc) func(args ...interface{}) string {
+	return func(args ...interface{}) string {
+		return MarkdownToLatex(LatexEscaper(nil)(args...), replace)
+	}
+}
+
+// MarkdownModifier converts value with MarkdownToLatex.
+func MarkdownModifier(value string, replace LatexEscapeFunc) (string, error) {
+	return MarkdownToLatex(value, replace), nil
+}
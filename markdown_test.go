@@ -0,0 +1,75 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import "testing"
+
+func TestMarkdownToLatex(t *testing.T) {
+	tests := []struct {
+		name, md, expected string
+	}{
+		{"emphasis", "*a* and _b_", `\emph{a} and \emph{b}`},
+		{"strong", "**a** and __b__", `\textbf{a} and \textbf{b}`},
+		{"strong emphasis", "***a***", `\emph{\textbf{a}}`},
+		{"strong emphasis underscore", "___a___", `\emph{\textbf{a}}`},
+		{"emphasis in strong", "**a *b* c**", `\textbf{a \emph{b} c}`},
+		{"strong in emphasis", "*a **b** c*", `\emph{a \textbf{b} c}`},
+		{"strong with extra star", "***a**", `*\textbf{a}`},
+		{"unclosed", "*a", `*a`},
+		{"space after opening", "a * b * c", `a * b * c`},
+		{"multiplication", "2*3*4", `2*3*4`},
+		{"multiplication with spaces", "2 * 3 * 4", `2 * 3 * 4`},
+		{"intraword star", "foo*bar*baz", `foo\emph{bar}baz`},
+		{"intraword underscore", "snake_case_name", `snake\_case\_name`},
+		{"code", "`a_b` and ``a`b``", "\\texttt{a\\_b} and \\texttt{a`b}"},
+		{"no emphasis in code", "`*a*`", `\texttt{*a*}`},
+		{"escaped", `\*a\* 50\%`, `*a* 50\%`},
+		{"text fragments", "a & b *c & d* e_f", `a \& b \emph{c \& d} e\_f`},
+		{"link", "[a *b*](http://x.org/a_b)", `\href{http://x.org/a_b}{a \emph{b}}`},
+		{"link with percent and hash", "[x](http://x.org/a%20b#c)", `\href{http://x.org/a\%20b\#c}{x}`},
+		{"link with parentheses", "[x](http://x.org/a_(b))", `\href{http://x.org/a_(b)}{x}`},
+		{"no link", "[a] (b)", `[a] (b)`},
+		{"autolink", "<http://x.org/?a=1&b=2#c>", `\url{http://x.org/?a=1&b=2\#c}`},
+		{"no autolink", "a <b> c", `a <b> c`},
+		{"paragraphs", "a\nb\n\nc", "a\nb\n\nc"},
+		{"bullet list", "- a\n* *b*\n+ c", "\\begin{itemize}\n\\item a\n\\item \\emph{b}\n\\item c\n\\end{itemize}"},
+		{"ordered list", "1. a\n2) b\n  continued", "\\begin{enumerate}\n\\item a\n\\item b\ncontinued\n\\end{enumerate}"},
+		{"list and paragraph", "a\n- b\n\nc", "a\n\n\\begin{itemize}\n\\item b\n\\end{itemize}\n\nc"},
+		{"list types", "- a\n1. b", "\\begin{itemize}\n\\item a\n\\end{itemize}\n\n\\begin{enumerate}\n\\item b\n\\end{enumerate}"},
+		{"crlf", "a\r\n\r\nb", "a\n\nb"},
+	}
+	replace := EscapeWithDefaults(nil)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := MarkdownToLatex(test.md, replace); got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestMarkdownFunc(t *testing.T) {
+	data := map[string]string{"MD": "**a & b**"}
+	got, err := executeTemplate(autoEscapeOptions(), data, `#(markdown .MD#)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := `\textbf{a \& b}`; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if got := MarkdownToLatex("*a & b*", nil); got != `\emph{a & b}` {
+		t.Errorf("nil replace: got %q", got)
+	}
+}
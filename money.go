@@ -0,0 +1,213 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Currency describes an ISO 4217 currency.
+type Currency struct {
+	// Code is the ISO 4217 code, for example EUR.
+	Code string
+	// Symbol is the LaTeX code for the symbol. It is not escaped, so it should
+	// only contain ASCII characters to work with all LaTeX engines.
+	Symbol string
+	// Digits is the number of digits after the decimal point (minor unit).
+	Digits int
+}
+
+// Currencies maps ISO 4217 codes to currencies.
+var Currencies = map[string]*Currency{
+	"EUR": {"EUR", `\texteuro{}`, 2},
+	"USD": {"USD", `\$`, 2},
+	"GBP": {"GBP", `\pounds{}`, 2},
+	"JPY": {"JPY", `\textyen{}`, 0},
+	"CNY": {"CNY", `CN\textyen{}`, 2},
+	"CHF": {"CHF", "CHF", 2},
+	"CAD": {"CAD", `CA\$`, 2},
+	"AUD": {"AUD", `A\$`, 2},
+	"NZD": {"NZD", `NZ\$`, 2},
+	"SEK": {"SEK", "kr", 2},
+	"NOK": {"NOK", "kr", 2},
+	"DKK": {"DKK", "kr.", 2},
+	"PLN": {"PLN", `z\l{}`, 2},
+	"CZK": {"CZK", `K\v{c}`, 2},
+	"HUF": {"HUF", "Ft", 2},
+	"INR": {"INR", "INR", 2},
+	"KRW": {"KRW", "KRW", 0},
+	"BRL": {"BRL", `R\$`, 2},
+	"MXN": {"MXN", `MX\$`, 2},
+}
+
+// LookupCurrency returns the currency with the given code (case insensitive).
+// For unknown codes that consist of three letters a currency with the code as
+// symbol and two digits is returned.
+func LookupCurrency(code string) (*Currency, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if c, has := Currencies[code]; has {
+		return c, nil
+	}
+	if len(code) == 3 && strings.Trim(code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") == "" {
+		return &Currency{code, code, 2}, nil
+	}
+	return nil, fmt.Errorf("invalid currency code \"%s\"", code)
+}
+
+// Money is an exact amount in a currency.
+type Money struct {
+	Amount   Decimal
+	Currency *Currency
+}
+
+// String returns the amount (with . as decimal separator) followed by the
+// currency code.
+func (m Money) String() string {
+	return m.Amount.String() + " " + m.Currency.Code
+}
+
+// Format formats the amount rounded to the digits of the currency with the
+// separators and the currency placement of loc (EnglishLocale if nil).
+// Example: 1.234,50~\texteuro{} for EUR and a German locale.
+func (m Money) Format(loc *Locale, mode RoundingMode) string {
+	if loc == nil {
+		loc = EnglishLocale
+	}
+	amount := m.Amount.Round(m.Currency.Digits, mode)
+	s := amount.Format(loc, true)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	if loc.CurrencyBefore {
+		return sign + m.Currency.Symbol + loc.CurrencySpace + s
+	}
+	return sign + s + loc.CurrencySpace + m.Currency.Symbol
+}
+
+// toMoneyArgs converts values to decimals. The currency is the currency of
+// all Money values, an error is returned if they have different currencies.
+// The currency is nil if no value is Money.
+func (f *NumberFormat) toMoneyArgs(values ...interface{}) ([]Decimal, *Currency, error) {
+	res := make([]Decimal, len(values))
+	var currency *Currency
+	for i, value := range values {
+		if m, ok := value.(Money); ok {
+			if currency != nil && currency.Code != m.Currency.Code {
+				return nil, nil, fmt.Errorf("can't combine amounts in %s and %s", currency.Code, m.Currency.Code)
+			}
+			currency = m.Currency
+			res[i] = m.Amount
+			continue
+		}
+		d, err := ToDecimal(value, f.Locale)
+		if err != nil {
+			return nil, nil, err
+		}
+		res[i] = d
+	}
+	return res, currency, nil
+}
+
+// moneyResult returns d as Money if currency is not nil and as Decimal
+// otherwise.
+func moneyResult(d Decimal, currency *Currency) interface{} {
+	if currency == nil {
+		return d
+	}
+	return Money{d, currency}
+}
+
+// Money is the template function "money". The arguments are an optional
+// currency code and the value. If no code is given the currency of the value
+// (if it is Money) or the currency of the locale is used. An error is returned
+// if the code differs from the currency of the value.
+// Example: #(money "EUR" .Price#) yields to 1.234,50~\texteuro{} for a German
+// locale.
+func (f *NumberFormat) Money(args ...interface{}) (string, error) {
+	var code string
+	switch len(args) {
+	case 1:
+	case 2:
+		code = plainString(args[0])
+	default:
+		return "", fmt.Errorf("money expects one or two arguments, got %d", len(args))
+	}
+	values, currency, err := f.toMoneyArgs(args[len(args)-1])
+	if err != nil {
+		return "", err
+	}
+	loc := f.Locale
+	if loc == nil {
+		loc = EnglishLocale
+	}
+	if code == "" && currency == nil {
+		code = loc.Currency
+	}
+	if code != "" {
+		c, err := LookupCurrency(code)
+		if err != nil {
+			return "", err
+		}
+		if currency != nil && currency.Code != c.Code {
+			return "", fmt.Errorf("can't format an amount in %s as %s", currency.Code, c.Code)
+		}
+		currency = c
+	}
+	return Money{values[0], currency}.Format(loc, f.Rounding), nil
+}
+
+// Mul is the template function "mul", it returns the exact product of all
+// values. The result is Money if a value is Money, otherwise a Decimal.
+// Example: #(money (mul .Quantity .Price)#).
+func (f *NumberFormat) Mul(values ...interface{}) (interface{}, error) {
+	decimals, currency, err := f.toMoneyArgs(values...)
+	if err != nil {
+		return nil, err
+	}
+	product := Decimal{big.NewRat(1, 1), 0}
+	for _, d := range decimals {
+		product.Value.Mul(product.Value, d.Rat())
+		product.Scale += d.Scale
+	}
+	return moneyResult(product, currency), nil
+}
+
+// Add is the template function "add", it returns the exact sum of all values,
+// see Mul.
+func (f *NumberFormat) Add(values ...interface{}) (interface{}, error) {
+	decimals, currency, err := f.toMoneyArgs(values...)
+	if err != nil {
+		return nil, err
+	}
+	return moneyResult(SumDecimals(decimals), currency), nil
+}
+
+// Vat is the template function "vat", it returns the tax for value with the
+// given rate in percent.
+// Example: #(money (vat 19 .Net)#) and #(money (add .Net (vat 19 .Net))#) for
+// the gross amount.
+func (f *NumberFormat) Vat(rate, value interface{}) (interface{}, error) {
+	decimals, currency, err := f.toMoneyArgs(rate, value)
+	if err != nil {
+		return nil, err
+	}
+	r, v := decimals[0], decimals[1]
+	tax := new(big.Rat).Mul(v.Rat(), r.Rat())
+	tax.Quo(tax, big.NewRat(100, 1))
+	return moneyResult(Decimal{tax, v.Scale + r.Scale + 2}, currency), nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"testing"
+	"unicode"
+)
+
+func TestMoneyFormat(t *testing.T) {
+	tests := []struct {
+		amount, code string
+		loc          *Locale
+		mode         RoundingMode
+		expected     string
+	}{
+		{"1234.5", "EUR", GermanLocale, RoundHalfUp, `1.234,50~\texteuro{}`},
+		{"1234.5", "USD", EnglishLocale, RoundHalfUp, `\$1,234.50`},
+		{"-1234.5", "USD", EnglishLocale, RoundHalfUp, `-\$1,234.50`},
+		{"-0.125", "EUR", FrenchLocale, RoundHalfEven, `-0,12~\texteuro{}`},
+		{"0.125", "EUR", GermanLocale, RoundHalfUp, `0,13~\texteuro{}`},
+		{"1234.5", "JPY", EnglishLocale, RoundHalfEven, `\textyen{}1,234`},
+		{"1234.5", "CHF", SwissLocale, RoundDown, `CHF~1'234.50`},
+		{"5", "XYZ", nil, RoundHalfUp, `XYZ5.00`},
+		{"1234.5", "PLN", GermanLocale, RoundHalfUp, `1.234,50~z\l{}`},
+		{"1234.5", "CZK", GermanLocale, RoundHalfUp, `1.234,50~K\v{c}`},
+	}
+	for _, test := range tests {
+		d, err := ParseDecimal(test.amount, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		currency, err := LookupCurrency(test.code)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := (Money{d, currency}).Format(test.loc, test.mode); got != test.expected {
+			t.Errorf("%s %s: expected %q, got %q", test.amount, test.code, test.expected, got)
+		}
+	}
+	if _, err := LookupCurrency("EURO"); err == nil {
+		t.Error("expected an error for an invalid currency code")
+	}
+}
+
+func TestCurrencySymbols(t *testing.T) {
+	for code, currency := range Currencies {
+		for _, r := range currency.Symbol {
+			if r > unicode.MaxASCII {
+				t.Errorf("%s: symbol %q is not ASCII", code, currency.Symbol)
+				break
+			}
+		}
+	}
+}
+
+func TestMoneyFuncs(t *testing.T) {
+	eur := Currencies["EUR"]
+	data := map[string]interface{}{
+		"Qty":   "3",
+		"Price": "19.99",
+		"M":     Money{Decimal{}, eur},
+		"N":     Money{Decimal{}, Currencies["USD"]},
+	}
+	opts := &TemplateOptions{Numbers: NumberFormat{Locale: GermanLocale}}
+	tests := []struct {
+		name, template, expected string
+	}{
+		{"locale currency", `#(money .Price#)`, `19,99~\texteuro{}`},
+		{"explicit currency", `#(money "chf" .Price#)`, `19,99~CHF`},
+		{"mul", `#(money (mul .Qty .Price)#)`, `59,97~\texteuro{}`},
+		{"vat", `#(money (vat 19 (mul .Qty .Price))#)`, `11,39~\texteuro{}`},
+		{"gross", `#(money (add (mul .Qty .Price) (vat 19 (mul .Qty .Price)))#)`, `71,36~\texteuro{}`},
+		{"money value", `#(money (add .M "2,5")#)`, `2,50~\texteuro{}`},
+		{"same currency", `#(money "EUR" (add .M 1)#)`, `1,00~\texteuro{}`},
+		{"money currency", `#(money (add .N 1)#)`, `1,00~\$`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := executeTemplate(opts, data, test.template)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+	for _, template := range []string{
+		`#(money "EUR" .N#)`,
+		`#(add .M .N#)`,
+		`#(money "EURO" .Price#)`,
+		`#(money "EUR" "USD" .Price#)`,
+		`#(money "abc"#)`,
+	} {
+		if got, err := executeTemplate(opts, data, template); err == nil {
+			t.Errorf("%s: expected an error, got %q", template, got)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// NewlinePolicy describes how line breaks in a value (for example a csv cell
+// with multiple lines) are converted to LaTeX.
+type NewlinePolicy int
+
+const (
+	// NewlineKeep keeps line breaks as they are. Note that an empty line starts
+	// a new paragraph in LaTeX.
+	NewlineKeep NewlinePolicy = iota
+	// NewlineBreak converts line breaks to \\.
+	NewlineBreak
+	// NewlineNewline converts line breaks to \newline.
+	NewlineNewline
+	// NewlinePar converts line breaks to \par.
+	NewlinePar
+	// NewlineSpace converts line breaks to a space.
+	NewlineSpace
+	// NewlineReject reports an error if the value contains a line break.
+	NewlineReject
+)
+
+func (policy NewlinePolicy) String() string {
+	switch policy {
+	case NewlineKeep:
+		return "keep"
+	case NewlineBreak:
+		return "break"
+	case NewlineNewline:
+		return "newline"
+	case NewlinePar:
+		return "par"
+	case NewlineSpace:
+		return "space"
+	case NewlineReject:
+		return "reject"
+	default:
+		return fmt.Sprintf("NewlinePolicy(%d)", int(policy))
+	}
+}
+
+// NewlinePolicyNames contains the names of all policies, see ParseNewlinePolicy.
+var NewlinePolicyNames = []string{"keep", "break", "newline", "par", "space", "reject"}
+
+// ParseNewlinePolicy parses a policy from its name, see NewlinePolicyNames.
+func ParseNewlinePolicy(s string) (NewlinePolicy, error) {
+	for i, name := range NewlinePolicyNames {
+		if s == name {
+			return NewlinePolicy(i), nil
+		}
+	}
+	return NewlineKeep, fmt.Errorf("invalid newline policy \"%s\": Must be one of %s",
+		s, strings.Join(NewlinePolicyNames, ", "))
+}
+
+// lineBreaks matches a sequence of line breaks (and whitespace between them).
+var lineBreaks = regexp.MustCompile(`[ \t]*(\r\n|\r|\n)(\s*(\r\n|\r|\n))*[ \t]*`)
+
+// Apply converts the line breaks in s. Consecutive line breaks (empty lines)
+// are converted only once. An error is returned for NewlineReject if s
+// contains a line break.
+func (policy NewlinePolicy) Apply(s string) (string, error) {
+	var replacement string
+	switch policy {
+	case NewlineKeep:
+		return s, nil
+	case NewlineBreak:
+		// {} prevents that a following [ is parsed as optional argument
+		replacement = `\\{}`
+	case NewlineNewline:
+		replacement = `\newline `
+	case NewlinePar:
+		replacement = `\par `
+	case NewlineSpace:
+		replacement = " "
+	case NewlineReject:
+		if strings.ContainsAny(s, "\r\n") {
+			return "", errors.New("value must not contain a line break")
+		}
+		return s, nil
+	default:
+		return "", fmt.Errorf("invalid newline policy %s", policy)
+	}
+	trimmed := strings.Trim(s, "\r\n")
+	return lineBreaks.ReplaceAllLiteralString(trimmed, replacement), nil
+}
+
+// Modifier returns an ExpandModifier that escapes the value with replace (if
+// not nil) and then applies the policy.
+func (policy NewlinePolicy) Modifier() ExpandModifier {
+	return func(value string, replace LatexEscapeFunc) (string, error) {
+		if replace != nil {
+			value = replace(value)
+		}
+		return policy.Apply(value)
+	}
+}
+
+// LatexNewlineEscaper works as LatexEscaper but applies the newline policy
+// after escaping.
+func LatexNewlineEscaper(replace LatexEscapeFunc, policy NewlinePolicy) func(args ...interface{}) (string, error) {
+	escaper := LatexEscaper(replace)
+	return func(args ...interface{}) (string, error) {
+		return policy.Apply(escaper(args...))
+	}
+}
+
+// LatexLines returns a function for templates that escapes its arguments with
+// replace and applies the newline policy given by name as first argument.
+// Example: #(latexnl "par" .Description#).
+func LatexLines(replace LatexEscapeFunc) func(policyName string, args ...interface{}) (string, error) {
+	escaper := LatexEscaper(replace)
+	return func(policyName string, args ...interface{}) (string, error) {
+		policy, err := ParseNewlinePolicy(policyName)
+		if err != nil {
+			return "", err
+		}
+		return policy.Apply(escaper(args...))
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import "testing"
+
+func TestNewlinePolicyApply(t *testing.T) {
+	tests := []struct {
+		policy       NewlinePolicy
+		in, expected string
+	}{
+		{NewlineKeep, "a\n\nb\n", "a\n\nb\n"},
+		{NewlineBreak, "a\nb", `a\\{}b`},
+		{NewlineBreak, "a \r\n\r\n  b", `a\\{}b`},
+		{NewlineBreak, "\na\n[b]\n", `a\\{}[b]`},
+		{NewlineNewline, "a\r\nb", `a\newline b`},
+		{NewlinePar, "a\n\n\nb\rc", `a\par b\par c`},
+		{NewlineSpace, "a\n \n\tb", "a b"},
+		{NewlineSpace, "ab", "ab"},
+		{NewlineReject, "a b", "a b"},
+	}
+	for _, test := range tests {
+		got, err := test.policy.Apply(test.in)
+		if err != nil {
+			t.Errorf("%s %q: unexpected error: %v", test.policy, test.in, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("%s %q: expected %q, got %q", test.policy, test.in, test.expected, got)
+		}
+	}
+	for _, in := range []string{"a\nb", "a\r", "\n"} {
+		if got, err := NewlineReject.Apply(in); err == nil {
+			t.Errorf("reject %q: expected an error, got %q", in, got)
+		}
+	}
+	if got, err := NewlinePolicy(42).Apply("a"); err == nil {
+		t.Errorf("invalid policy: expected an error, got %q", got)
+	}
+}
+
+func TestParseNewlinePolicy(t *testing.T) {
+	for i, name := range NewlinePolicyNames {
+		policy, err := ParseNewlinePolicy(name)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if policy != NewlinePolicy(i) || policy.String() != name {
+			t.Errorf("%s: got policy %s", name, policy)
+		}
+	}
+	for _, name := range []string{"", "Break", "lines"} {
+		if _, err := ParseNewlinePolicy(name); err == nil {
+			t.Errorf("%q: expected an error", name)
+		}
+	}
+}
+
+func TestNewlineFuncs(t *testing.T) {
+	data := map[string]string{"D": "a & b\nc"}
+	tests := []struct {
+		name, template, expected string
+		policy                   NewlinePolicy
+		autoEscape               bool
+	}{
+		{"latex keep", `#(latex .D#)`, "a \\& b\nc", NewlineKeep, false},
+		{"latex break", `#(latex .D#)`, `a \& b\\{}c`, NewlineBreak, false},
+		{"latexnl", `#(latexnl "par" .D#)`, `a \& b\par c`, NewlineReject, false},
+		{"auto escape", `#(.D#) $#(.D#)$`, "a \\& b\\newline c $a \\& b\nc$", NewlineNewline, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := &TemplateOptions{Replace: EscapeWithDefaults(nil), Newlines: test.policy, AutoEscape: test.autoEscape}
+			got, err := executeTemplate(opts, data, test.template)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+	opts := &TemplateOptions{Replace: EscapeWithDefaults(nil), Newlines: NewlineReject}
+	for _, template := range []string{`#(latex .D#)`, `#(latexnl "foo" .D#)`} {
+		if got, err := executeTemplate(opts, data, template); err == nil {
+			t.Errorf("%s: expected an error, got %q", template, got)
+		}
+	}
+	opts.AutoEscape = true
+	if got, err := executeTemplate(opts, data, `#(.D#)`); err == nil {
+		t.Errorf("auto escape: expected an error, got %q", got)
+	}
+}
+
+func TestExpandNewlines(t *testing.T) {
+	opts := &ExpandOptions{
+		Replace:             EscapeWithDefaults(nil),
+		Modifiers:           DefaultExpandModifiers(),
+		Newlines:            NewlineSpace,
+		PlaceholderNewlines: map[string]NewlinePolicy{"ADDRESS": NewlineBreak},
+	}
+	handler, err := NewConstHandlerWithOptions(map[string]string{"NAME": "a\nb", "ADDRESS": "c\nd"}, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := handler.HandleLineErr("NAME / ADDRESS / NAME|par / ADDRESS|newline")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := `a b / c\\{}d / a\par b / c\newline d`; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	opts.PlaceholderNewlines = map[string]NewlinePolicy{"ADDRESS": NewlineReject}
+	if _, err := NewConstHandlerWithOptions(map[string]string{"ADDRESS": "c\nd"}, opts); err == nil {
+		t.Error("const handler: expected an error")
+	}
+	rowHandler := NewRowHandlerWithOptions(map[string]string{"ADDRESS": "address"}, opts)
+	if _, err := rowHandler.ForColumn(NewColumn([]string{"address"}, []string{"c\nd"})); err == nil {
+		t.Error("row handler: expected an error")
+	}
+	if _, err := rowHandler.ForColumn(NewColumn([]string{"address"}, []string{"c d"})); err != nil {
+		t.Errorf("row handler: unexpected error: %v", err)
+	}
+}
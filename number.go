@@ -0,0 +1,412 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// RoundingMode describes how numbers are rounded.
+type RoundingMode int
+
+const (
+	// RoundHalfUp rounds to the nearest number, ties are rounded away from
+	// zero (2.5 becomes 3).
+	RoundHalfUp RoundingMode = iota
+	// RoundHalfEven rounds to the nearest number, ties are rounded to the
+	// nearest even number (2.5 becomes 2).
+	RoundHalfEven
+	// RoundDown rounds towards zero (truncation).
+	RoundDown
+	// RoundUp rounds away from zero.
+	RoundUp
+)
+
+func (mode RoundingMode) String() string {
+	switch mode {
+	case RoundHalfUp:
+		return "half-up"
+	case RoundHalfEven:
+		return "half-even"
+	case RoundDown:
+		return "down"
+	case RoundUp:
+		return "up"
+	default:
+		return fmt.Sprintf("RoundingMode(%d)", int(mode))
+	}
+}
+
+// ParseRoundingMode parses a rounding mode from its name, the names are
+// "half-up", "half-even", "down" and "up".
+func ParseRoundingMode(s string) (RoundingMode, error) {
+	switch strings.ToLower(s) {
+	case "half-up", "halfup":
+		return RoundHalfUp, nil
+	case "half-even", "halfeven", "bankers":
+		return RoundHalfEven, nil
+	case "down", "truncate":
+		return RoundDown, nil
+	case "up":
+		return RoundUp, nil
+	default:
+		return RoundHalfUp, fmt.Errorf("invalid rounding mode \"%s\": Must be half-up, half-even, down or up", s)
+	}
+}
+
+// Decimal is an exact decimal number together with the number of digits after
+// the decimal point that are shown when formatting it. A nil Value is treated
+// as 0, so the zero value of Decimal is 0.
+type Decimal struct {
+	Value *big.Rat
+	Scale int
+}
+
+// Rat returns the value of d, a new zero value if Value is nil.
+func (d Decimal) Rat() *big.Rat {
+	if d.Value == nil {
+		return new(big.Rat)
+	}
+	return d.Value
+}
+
+// String returns the number with Scale digits after the decimal point and .
+// as decimal separator.
+func (d Decimal) String() string {
+	return d.Rat().FloatString(d.Scale)
+}
+
+// maxScale is the maximal scale of a Decimal that is created from a value that
+// has no finite decimal representation (for example 1/3).
+const maxScale = 10
+
+// decimalScale returns the number of digits after the decimal point of r, at
+// most maxScale.
+func decimalScale(r *big.Rat) int {
+	if r.IsInt() {
+		return 0
+	}
+	ten := big.NewInt(10)
+	x := new(big.Rat).Set(r)
+	for scale := 1; scale < maxScale; scale++ {
+		x.Mul(x, new(big.Rat).SetInt(ten))
+		if x.IsInt() {
+			return scale
+		}
+	}
+	return maxScale
+}
+
+// parsePlainDecimal parses a number with . as decimal separator and an
+// optional exponent.
+func parsePlainDecimal(s string) (Decimal, bool) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || strings.ContainsAny(s, "/") {
+		return Decimal{}, false
+	}
+	mantissa, exponent := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		mantissa = s[:i]
+		if _, err := fmt.Sscan(s[i+1:], &exponent); err != nil {
+			return Decimal{}, false
+		}
+	}
+	scale := 0
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		scale = len(mantissa) - i - 1
+	}
+	scale -= exponent
+	if scale < 0 {
+		scale = 0
+	}
+	return Decimal{r, scale}, true
+}
+
+// groupSeparators returns the separators that are accepted between groups of
+// three digits for loc: The thousands separator of loc and spaces.
+func groupSeparators(loc *Locale) []string {
+	res := make([]string, 0, 6)
+	for _, sep := range []string{loc.Thousands, " ", "\u00a0", "\u202f", `\,`, "~"} {
+		if sep != "" && sep != loc.Decimal {
+			res = append(res, sep)
+		}
+	}
+	return res
+}
+
+// isDigits returns true if s is not empty and contains only ASCII digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseLocalizedDecimal parses a number with the decimal separator of loc.
+// The integer part can be divided into groups of three digits by the
+// separators from groupSeparators, for example 1.234.567,5 for a German
+// locale. The first group has at most three digits.
+func parseLocalizedDecimal(s string, loc *Locale) (Decimal, bool) {
+	sign := ""
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		sign, s = s[:1], s[1:]
+	}
+	intPart, fracPart := s, ""
+	if i := strings.Index(s, loc.Decimal); i >= 0 {
+		intPart, fracPart = s[:i], s[i+len(loc.Decimal):]
+		if !isDigits(fracPart) {
+			return Decimal{}, false
+		}
+	}
+	groups := []string{intPart}
+	for _, sep := range groupSeparators(loc) {
+		var split []string
+		for _, group := range groups {
+			split = append(split, strings.Split(group, sep)...)
+		}
+		groups = split
+	}
+	for i, group := range groups {
+		if !isDigits(group) || (len(groups) > 1 && (len(group) > 3 || (i > 0 && len(group) != 3))) {
+			return Decimal{}, false
+		}
+	}
+	normalized := sign + strings.Join(groups, "")
+	if fracPart != "" {
+		normalized += "." + fracPart
+	}
+	return parsePlainDecimal(normalized)
+}
+
+// ParseDecimal parses a number. s is parsed as a plain number with . as
+// decimal separator (and an optional exponent, for example 1.5e3) and as a
+// number with the separators of loc, for example 1.234,5 is parsed as 1234.5
+// for a German locale. Thousands separators (the one from loc and spaces) are
+// only accepted between groups of three digits before the decimal separator.
+//
+// An error is returned if s can't be parsed or if both ways yield different
+// numbers, for example 1.234 for a German locale (1.234 or 1234).
+//
+// The scale of the result is the number of digits after the decimal point in s.
+// If loc is nil EnglishLocale is used.
+func ParseDecimal(s string, loc *Locale) (Decimal, error) {
+	if loc == nil {
+		loc = EnglishLocale
+	}
+	trimmed := strings.TrimSpace(s)
+	plain, plainOk := parsePlainDecimal(trimmed)
+	localized, localizedOk := parseLocalizedDecimal(trimmed, loc)
+	switch {
+	case plainOk && localizedOk && plain.Rat().Cmp(localized.Rat()) != 0:
+		return Decimal{}, fmt.Errorf("ambiguous number \"%s\": Could be %s or %s", s, plain, localized)
+	case plainOk:
+		return plain, nil
+	case localizedOk:
+		return localized, nil
+	default:
+		return Decimal{}, fmt.Errorf("can't parse \"%s\" as number", s)
+	}
+}
+
+// ToDecimal converts a value to a Decimal. Supported are Decimal, Money (the
+// amount is used), *big.Rat, all int and float types and strings (parsed with ParseDecimal), all other
+// values are formatted with fmt and then parsed.
+func ToDecimal(value interface{}, loc *Locale) (Decimal, error) {
+	switch v := value.(type) {
+	case Decimal:
+		return v, nil
+	case Money:
+		return v.Amount, nil
+	case *big.Rat:
+		if v == nil {
+			return Decimal{}, nil
+		}
+		return Decimal{v, decimalScale(v)}, nil
+	case string:
+		return ParseDecimal(v, loc)
+	case float32, float64:
+		return ParseDecimal(fmt.Sprintf("%g", v), nil)
+	default:
+		return ParseDecimal(plainString(v), loc)
+	}
+}
+
+// Round returns d rounded to scale digits after the decimal point, the result
+// has the given scale.
+func (d Decimal) Round(scale int, mode RoundingMode) Decimal {
+	if scale < 0 {
+		scale = 0
+	}
+	factor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+	x := new(big.Rat).Mul(d.Rat(), new(big.Rat).SetInt(factor))
+	num := new(big.Int).Abs(x.Num())
+	den := x.Denom()
+	q, m := new(big.Int).QuoRem(num, den, new(big.Int))
+	if m.Sign() != 0 {
+		// compare twice the remainder with the denominator to find ties
+		cmp := new(big.Int).Lsh(m, 1).Cmp(den)
+		roundUp := false
+		switch mode {
+		case RoundHalfUp:
+			roundUp = cmp >= 0
+		case RoundHalfEven:
+			roundUp = cmp > 0 || (cmp == 0 && q.Bit(0) == 1)
+		case RoundUp:
+			roundUp = true
+		}
+		if roundUp {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	if x.Sign() < 0 {
+		q.Neg(q)
+	}
+	return Decimal{new(big.Rat).SetFrac(q, factor), scale}
+}
+
+// groupDigits inserts sep between groups of three digits in the integer part
+// digits.
+func groupDigits(digits, sep string) string {
+	if len(digits) <= 3 || sep == "" {
+		return digits
+	}
+	var b strings.Builder
+	first := len(digits) % 3
+	if first == 0 {
+		first = 3
+	}
+	b.WriteString(digits[:first])
+	for i := first; i < len(digits); i += 3 {
+		b.WriteString(sep)
+		b.WriteString(digits[i : i+3])
+	}
+	return b.String()
+}
+
+// Format formats d with the separators from loc, if group is true the
+// thousands separator is used. If loc is nil EnglishLocale is used.
+func (d Decimal) Format(loc *Locale, group bool) string {
+	if loc == nil {
+		loc = EnglishLocale
+	}
+	s := d.String()
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	if group {
+		intPart = groupDigits(intPart, loc.Thousands)
+	}
+	if fracPart != "" {
+		return sign + intPart + loc.Decimal + fracPart
+	}
+	return sign + intPart
+}
+
+// NumberFormat describes how numbers are formatted by the functions "num",
+// "fixed", "percent", "thousands" and "round".
+type NumberFormat struct {
+	// Locale defines the separators, if it is nil EnglishLocale is used.
+	Locale *Locale
+	// Rounding is the rounding mode for "fixed" and "percent".
+	Rounding RoundingMode
+	// SIUnitX enables siunitx output: Numbers are written as \num{...} and
+	// percentages as \SI{...}{\percent}. siunitx is responsible for the
+	// separators then.
+	SIUnitX bool
+}
+
+// format returns the LaTeX code for d.
+func (f *NumberFormat) format(d Decimal, group bool) string {
+	if f.SIUnitX {
+		return `\num{` + d.String() + `}`
+	}
+	return d.Format(f.Locale, group)
+}
+
+// Num formats value with the decimal separator of the locale, the number of
+// digits after the decimal point is not changed.
+// Example: Num("1234.5") yields to 1234,5 for a German locale.
+func (f *NumberFormat) Num(value interface{}) (string, error) {
+	d, err := ToDecimal(value, f.Locale)
+	if err != nil {
+		return "", err
+	}
+	return f.format(d, false), nil
+}
+
+// Thousands works as Num but separates groups of three digits with the
+// thousands separator of the locale.
+// Example: Thousands("1234.5") yields to 1.234,5 for a German locale.
+func (f *NumberFormat) Thousands(value interface{}) (string, error) {
+	d, err := ToDecimal(value, f.Locale)
+	if err != nil {
+		return "", err
+	}
+	return f.format(d, true), nil
+}
+
+// Round returns value rounded to digits digits after the decimal point. The
+// result is not formatted, so it can be passed to the other functions.
+// Example: Thousands(Round(2, "1234.567")) yields to 1.234,57 for a German
+// locale.
+func (f *NumberFormat) Round(digits int, value interface{}) (Decimal, error) {
+	d, err := ToDecimal(value, f.Locale)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return d.Round(digits, f.Rounding), nil
+}
+
+// Fixed formats value rounded to digits digits after the decimal point.
+// Example: Fixed(2, "1234.5") yields to 1234,50 for a German locale.
+func (f *NumberFormat) Fixed(digits int, value interface{}) (string, error) {
+	d, err := ToDecimal(value, f.Locale)
+	if err != nil {
+		return "", err
+	}
+	return f.format(d.Round(digits, f.Rounding), false), nil
+}
+
+// Percent formats value (a fraction) as percentage rounded to digits digits
+// after the decimal point.
+// Example: Percent(1, "0.1234") yields to 12,3\,\% for a German locale.
+func (f *NumberFormat) Percent(digits int, value interface{}) (string, error) {
+	d, err := ToDecimal(value, f.Locale)
+	if err != nil {
+		return "", err
+	}
+	d.Value = new(big.Rat).Mul(d.Rat(), big.NewRat(100, 1))
+	d = d.Round(digits, f.Rounding)
+	if f.SIUnitX {
+		return `\SI{` + d.String() + `}{\percent}`, nil
+	}
+	loc := f.Locale
+	if loc == nil {
+		loc = EnglishLocale
+	}
+	return d.Format(loc, false) + loc.Percent, nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import "testing"
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in       string
+		loc      *Locale
+		expected string
+	}{
+		{"1234.5", EnglishLocale, "1234.5"},
+		{"1,234.5", EnglishLocale, "1234.5"},
+		{"1,234,567", EnglishLocale, "1234567"},
+		{"-1,234.50", EnglishLocale, "-1234.50"},
+		{"1.5e3", EnglishLocale, "1500"},
+		{" 42 ", EnglishLocale, "42"},
+		{"1.234,5", GermanLocale, "1234.5"},
+		{"1.234.567,89", GermanLocale, "1234567.89"},
+		{"1,5", GermanLocale, "1.5"},
+		{"1.5", GermanLocale, "1.5"},
+		{"1234.5", GermanLocale, "1234.5"},
+		{"1 234,5", GermanLocale, "1234.5"},
+		{"1234", GermanLocale, "1234"},
+	}
+	for _, test := range tests {
+		d, err := ParseDecimal(test.in, test.loc)
+		if err != nil {
+			t.Errorf("ParseDecimal(%q, %s): unexpected error: %v", test.in, test.loc.Name, err)
+			continue
+		}
+		if got := d.String(); got != test.expected {
+			t.Errorf("ParseDecimal(%q, %s): expected %s, got %s", test.in, test.loc.Name, test.expected, got)
+		}
+	}
+}
+
+func TestParseDecimalErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		loc *Locale
+	}{
+		{"1,5", EnglishLocale},
+		{"1,23", EnglishLocale},
+		{"12,34,567", EnglishLocale},
+		{"1,234.5,6", EnglishLocale},
+		{"1.234.5", EnglishLocale},
+		{"1.234", GermanLocale},
+		{"1.23,5", GermanLocale},
+		{"1,234.5", GermanLocale},
+		{"1,2,3", GermanLocale},
+		{",5", EnglishLocale},
+		{"abc", EnglishLocale},
+		{"", EnglishLocale},
+		{"1/2", EnglishLocale},
+	}
+	for _, test := range tests {
+		if d, err := ParseDecimal(test.in, test.loc); err == nil {
+			t.Errorf("ParseDecimal(%q, %s): expected an error, got %s", test.in, test.loc.Name, d)
+		}
+	}
+}
+
+func TestDecimalRound(t *testing.T) {
+	tests := []struct {
+		in       string
+		scale    int
+		mode     RoundingMode
+		expected string
+	}{
+		{"2.345", 2, RoundHalfUp, "2.35"},
+		{"2.345", 2, RoundHalfEven, "2.34"},
+		{"2.355", 2, RoundHalfEven, "2.36"},
+		{"2.349", 2, RoundDown, "2.34"},
+		{"2.341", 2, RoundUp, "2.35"},
+		{"-2.345", 2, RoundHalfUp, "-2.35"},
+		{"-2.345", 2, RoundHalfEven, "-2.34"},
+		{"-2.349", 2, RoundDown, "-2.34"},
+		{"-2.341", 2, RoundUp, "-2.35"},
+		{"0.5", 0, RoundHalfEven, "0"},
+		{"1.5", 0, RoundHalfEven, "2"},
+		{"1.2", 3, RoundHalfUp, "1.200"},
+		{"1234.5", -1, RoundHalfUp, "1235"},
+	}
+	for _, test := range tests {
+		d, err := ParseDecimal(test.in, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := d.Round(test.scale, test.mode).String(); got != test.expected {
+			t.Errorf("%s rounded to %d (%s): expected %s, got %s", test.in, test.scale, test.mode, test.expected, got)
+		}
+	}
+}
+
+func TestDecimalZeroValue(t *testing.T) {
+	var d Decimal
+	if got := d.String(); got != "0" {
+		t.Errorf("expected 0, got %s", got)
+	}
+	if got := d.Round(2, RoundHalfUp).Format(GermanLocale, true); got != "0,00" {
+		t.Errorf("expected 0,00, got %s", got)
+	}
+	f := &NumberFormat{}
+	if got, err := f.Percent(1, d); err != nil || got != "0.0"+EnglishLocale.Percent {
+		t.Errorf("unexpected result %q (error %v)", got, err)
+	}
+	if sum, err := f.Add(d, "1.5"); err != nil || sum.(Decimal).String() != "1.5" {
+		t.Errorf("unexpected sum %v (error %v)", sum, err)
+	}
+	if product, err := f.Mul(d, "1.5"); err != nil || product.(Decimal).String() != "0.0" {
+		t.Errorf("unexpected product %v (error %v)", product, err)
+	}
+}
+
+func TestNumberFormat(t *testing.T) {
+	f := &NumberFormat{Locale: GermanLocale, Rounding: RoundHalfUp}
+	if got, err := f.Thousands("1234567.5"); err != nil || got != "1.234.567,5" {
+		t.Errorf("thousands: unexpected result %q (error %v)", got, err)
+	}
+	if got, err := f.Fixed(2, "1.234,567"); err != nil || got != "1234,57" {
+		t.Errorf("fixed: unexpected result %q (error %v)", got, err)
+	}
+	f.SIUnitX = true
+	if got, err := f.Num("1.234,5"); err != nil || got != `\num{1234.5}` {
+		t.Errorf("siunitx: unexpected result %q (error %v)", got, err)
+	}
+}
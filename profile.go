@@ -0,0 +1,254 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EscapeProfile describes how LaTeX special characters are escaped.
+//
+// Replacers are combined with DefaultReplacers and take precedence over them,
+// see EscapeWithOverrides. If
+// Transliterate is true non-ASCII runes are converted to LaTeX commands after
+// escaping, see Transliterator. A disabled profile does not escape at all.
+type EscapeProfile struct {
+	Disabled      bool
+	Replacers     []string
+	Transliterate bool
+	Fallback      UnicodeFallback
+}
+
+// EscapeFunc returns the escape function described by the profile. For
+// disabled profiles it returns nil.
+func (p *EscapeProfile) EscapeFunc() LatexEscapeFunc {
+	if p.Disabled {
+		return nil
+	}
+	replace := EscapeWithOverrides(p.Replacers)
+	if p.Transliterate {
+		return NewTransliterator(p.Fallback).EscapeFunc(replace)
+	}
+	return replace
+}
+
+// MathEscapeFunc returns the escape function for math mode described by the
+// profile: Replacers are combined with MathReplacers (see
+// MathEscapeWithOverrides) and transliterated runes are wrapped in \mbox{...}.
+// For disabled profiles it returns nil.
+func (p *EscapeProfile) MathEscapeFunc() LatexEscapeFunc {
+	if p.Disabled {
+		return nil
+	}
+	replace := MathEscapeWithOverrides(p.Replacers)
+	if p.Transliterate {
+		t := NewTransliterator(p.Fallback)
+		t.Math = true
+		return t.EscapeFunc(replace)
+	}
+	return replace
+}
+
+var (
+	// EscapeProfiles contains the named escape profiles.
+	//
+	// "default" only uses DefaultReplacers and keeps non-ASCII runes as they
+	// are. "pdflatex" transliterates non-ASCII runes and reports an error if
+	// this is not possible. XeLaTeX and LuaLaTeX support Unicode, so "xelatex"
+	// and "lualatex" don't transliterate either. "none" disables escaping.
+	EscapeProfiles = map[string]*EscapeProfile{
+		"default":  {},
+		"pdflatex": {Transliterate: true, Fallback: FallbackError},
+		"xelatex":  {},
+		"lualatex": {},
+		"none":     {Disabled: true},
+	}
+)
+
+// replacerList is a list of replacers in a profile file. It is either a list
+// of pairs [old, new] or a flat list old1, new1, old2, new2, ... as in
+// DefaultReplacers.
+type replacerList []string
+
+func pairsToReplacers(pairs [][]string) (replacerList, error) {
+	res := make(replacerList, 0, 2*len(pairs))
+	for _, pair := range pairs {
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid replacer %v: Must be a pair [old, new]", pair)
+		}
+		res = append(res, pair[0], pair[1])
+	}
+	return res, nil
+}
+
+func flatToReplacers(flat []string) (replacerList, error) {
+	if len(flat)%2 != 0 {
+		return nil, fmt.Errorf("invalid list of replacers: Must contain an even number of strings, got %d", len(flat))
+	}
+	return replacerList(flat), nil
+}
+
+func (l *replacerList) UnmarshalJSON(data []byte) error {
+	var pairs [][]string
+	if err := json.Unmarshal(data, &pairs); err == nil {
+		*l, err = pairsToReplacers(pairs)
+		return err
+	}
+	var flat []string
+	if err := json.Unmarshal(data, &flat); err != nil {
+		return err
+	}
+	var err error
+	*l, err = flatToReplacers(flat)
+	return err
+}
+
+func (l *replacerList) UnmarshalYAML(node *yaml.Node) error {
+	var pairs [][]string
+	if err := node.Decode(&pairs); err == nil {
+		*l, err = pairsToReplacers(pairs)
+		return err
+	}
+	var flat []string
+	if err := node.Decode(&flat); err != nil {
+		return err
+	}
+	var err error
+	*l, err = flatToReplacers(flat)
+	return err
+}
+
+// escapeProfileContent is the content of an escape profile file.
+type escapeProfileContent struct {
+	Replacers     replacerList `json:"replacers" yaml:"replacers"`
+	Transliterate bool         `json:"transliterate" yaml:"transliterate"`
+	Fallback      string       `json:"fallback" yaml:"fallback"`
+}
+
+func (content *escapeProfileContent) profile() (*EscapeProfile, error) {
+	fallback := FallbackError
+	if content.Fallback != "" {
+		var err error
+		fallback, err = ParseUnicodeFallback(content.Fallback)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &EscapeProfile{
+		Replacers:     content.Replacers,
+		Transliterate: content.Transliterate,
+		Fallback:      fallback,
+	}, nil
+}
+
+// EscapeProfileJSON parses an escape profile. It must be a dictionary with the
+// following optional entries: "replacers" is a list of pairs [old, new] (or a
+// flat list as DefaultReplacers), "transliterate" is a bool and "fallback" is
+// the name of a UnicodeFallback (see ParseUnicodeFallback). Alternatively it
+// can be just the list of replacers.
+//
+// Example: {"replacers": [["€", "\\EUR{}"]], "transliterate": true}.
+func EscapeProfileJSON(r io.Reader) (*EscapeProfile, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	var content escapeProfileContent
+	var err error
+	if strings.HasPrefix(strings.TrimSpace(string(raw)), "[") {
+		err = json.Unmarshal(raw, &content.Replacers)
+	} else {
+		dec := json.NewDecoder(strings.NewReader(string(raw)))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&content)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return content.profile()
+}
+
+// EscapeProfileYAML works as EscapeProfileJSON but parses YAML.
+func EscapeProfileYAML(r io.Reader) (*EscapeProfile, error) {
+	var node yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&node); err != nil {
+		return nil, err
+	}
+	var content escapeProfileContent
+	var err error
+	if len(node.Content) > 0 && node.Content[0].Kind == yaml.SequenceNode {
+		err = node.Decode(&content.Replacers)
+	} else {
+		err = node.Decode(&content)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return content.profile()
+}
+
+// EscapeProfileFromFile reads an escape profile from a file. Files ending in
+// ".yaml" or ".yml" are parsed with EscapeProfileYAML, all other files with
+// EscapeProfileJSON.
+func EscapeProfileFromFile(file string) (*EscapeProfile, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	var profile *EscapeProfile
+	defer func() {
+		closeErr := f.Close()
+		if err == nil && closeErr != nil {
+			profile = nil
+			err = closeErr
+		}
+	}()
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		profile, err = EscapeProfileYAML(f)
+	default:
+		profile, err = EscapeProfileJSON(f)
+	}
+	return profile, err
+}
+
+// LookupEscapeProfile returns the profile with the given name from
+// EscapeProfiles. If there is no such profile and name ends in ".json",
+// ".yaml" or ".yml" the profile is read from the file with
+// EscapeProfileFromFile.
+func LookupEscapeProfile(name string) (*EscapeProfile, error) {
+	if profile, has := EscapeProfiles[name]; has {
+		return profile, nil
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".yaml", ".yml":
+		return EscapeProfileFromFile(name)
+	}
+	names := make([]string, 0, len(EscapeProfiles))
+	for profileName := range EscapeProfiles {
+		names = append(names, profileName)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("invalid escape profile \"%s\": Must be one of %s or a json / yaml file",
+		name, strings.Join(names, ", "))
+}
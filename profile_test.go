@@ -0,0 +1,155 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEscapePrecedence(t *testing.T) {
+	additional := []string{"~", `\string~`, "€", `\euro{}`}
+	if got, expected := EscapeWithDefaults(additional)("~€"), `\textasciitilde \euro{}`; got != expected {
+		t.Errorf("EscapeWithDefaults: expected %q, got %q", expected, got)
+	}
+	if got, expected := EscapeWithOverrides(additional)("~€"), `\string~\euro{}`; got != expected {
+		t.Errorf("EscapeWithOverrides: expected %q, got %q", expected, got)
+	}
+}
+
+func TestEscapeProfiles(t *testing.T) {
+	tests := []struct {
+		profile, in, expected string
+	}{
+		{"default", "Müller & ~", `Müller \& \textasciitilde `},
+		{"pdflatex", "Müller & ~", `M\"{u}ller \& \textasciitilde `},
+		{"xelatex", "Müller & ~", `Müller \& \textasciitilde `},
+		{"lualatex", "Müller & ~", `Müller \& \textasciitilde `},
+		{"none", "Müller & ~", "Müller & ~"},
+	}
+	for _, test := range tests {
+		profile, err := LookupEscapeProfile(test.profile)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got := test.in
+		if replace := profile.EscapeFunc(); replace != nil {
+			got = replace(got)
+		}
+		if got != test.expected {
+			t.Errorf("profile %s: expected %q, got %q", test.profile, test.expected, got)
+		}
+	}
+}
+
+func TestLookupEscapeProfile(t *testing.T) {
+	for _, name := range []string{"default", "pdflatex", "xelatex", "lualatex", "none"} {
+		if _, err := LookupEscapeProfile(name); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+	if _, err := LookupEscapeProfile("latex"); err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+}
+
+func TestEscapeProfileJSON(t *testing.T) {
+	profile, err := EscapeProfileJSON(strings.NewReader(`{"replacers": [["~", "\\string~"]]}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, expected := profile.EscapeFunc()("a~&"), `a\string~\&`; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestEscapeProfileMath(t *testing.T) {
+	profile := &EscapeProfile{
+		Replacers:     []string{"€", `\EUR{}`},
+		Transliterate: true,
+		Fallback:      FallbackError,
+	}
+	opts := &TemplateOptions{
+		Replace:     profile.EscapeFunc(),
+		MathReplace: profile.MathEscapeFunc(),
+		AutoEscape:  true,
+	}
+	data := map[string]string{"X": "5€ ~ µ", "Y": "ä"}
+	got, err := executeTemplate(opts, data, `#(.X#) $#(.X#)$ $#(mathlatex .Y#)$`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `5\EUR{} \textasciitilde  \textmu{} $5\EUR{} \sim  \mbox{\textmu{}}$ $\mbox{\"{a}}$`
+	if got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if _, err := executeTemplate(opts, map[string]string{"X": "世"}, `$#(.X#)$`); err == nil {
+		t.Error("expected an error for a rune that can't be transliterated")
+	}
+}
+
+func TestEscapeProfileUnicodeErrors(t *testing.T) {
+	profile, err := LookupEscapeProfile("pdflatex")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	opts := &ExpandOptions{Replace: profile.EscapeFunc(), Modifiers: DefaultExpandModifiers()}
+	if _, err := NewConstHandlerWithOptions(map[string]string{"NAME": "世"}, opts); err == nil {
+		t.Error("const handler: expected an error")
+	}
+	rowHandler := NewRowHandlerWithOptions(map[string]string{"NAME": "name"}, opts)
+	column := NewColumn([]string{"name"}, []string{"世"})
+	if _, err := rowHandler.ForColumn(column); err == nil {
+		t.Error("ForColumn: expected an error")
+	}
+	if _, err := rowHandler.WithColumn(column).HandleLineErr("NAME"); err == nil {
+		t.Error("HandleLineErr: expected an error")
+	}
+	if _, err := ApplyExpandHandlersErr("NAME|math", rowHandler.WithColumn(column)); err == nil {
+		t.Error("modifier: expected an error")
+	}
+
+	data := map[string]interface{}{"Name": "世", "Date": "2024-03-01", "Price": "2.5"}
+	templateOpts := &TemplateOptions{
+		Replace: profile.EscapeFunc(),
+		Numbers: NumberFormat{Locale: GermanLocale},
+		Dates:   DateFormat{Locale: GermanLocale},
+	}
+	for _, autoEscape := range []bool{false, true} {
+		templateOpts.AutoEscape = autoEscape
+		tests := []struct {
+			template, expected string
+		}{
+			{`#(date "long" .Date#)`, `1. M\"{a}rz 2024`},
+			{`#(date "Mon" .Date#) #(upper "ä"#)`, `Fr \"{A}`},
+			{`#(money "PLN" .Price#)`, `2,50~z\l{}`},
+		}
+		for _, test := range tests {
+			got, err := executeTemplate(templateOpts, data, test.template)
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.template, err)
+				continue
+			}
+			if got != test.expected {
+				t.Errorf("%s: expected %q, got %q", test.template, test.expected, got)
+			}
+		}
+		for _, template := range []string{`#(upper .Name#)`, `#(latex .Name#)`, `#(trim .Name | lower#)`} {
+			if got, err := executeTemplate(templateOpts, data, template); err == nil {
+				t.Errorf("%s (auto escape %v): expected an error, got %q", template, autoEscape, got)
+			}
+		}
+	}
+}
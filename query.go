@@ -0,0 +1,509 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Filter returns a new collection with the same head that contains all columns
+// for which keep returns true.
+func (c *Collection) Filter(keep func(col *Column) bool) *Collection {
+	cols := make([]*Column, 0, len(c.Columns))
+	for _, col := range c.Columns {
+		if keep(col) {
+			cols = append(cols, col)
+		}
+	}
+	return &Collection{c.Head, cols}
+}
+
+// compareValues compares two entries: If both are numbers (see ParseDecimal
+// with the given locale) they're compared as numbers, otherwise as strings.
+func compareValues(a, b string, loc *Locale) int {
+	da, errA := ParseDecimal(a, loc)
+	db, errB := ParseDecimal(b, loc)
+	if errA == nil && errB == nil {
+		return da.Rat().Cmp(db.Rat())
+	}
+	return strings.Compare(a, b)
+}
+
+// WhereOperators contains the operators supported by Where.
+var WhereOperators = []string{"==", "!=", "<", "<=", ">", ">=", "contains", "prefix", "suffix", "matches"}
+
+// Where returns a new collection that contains all columns whose entry with
+// the given row name satisfies the condition "entry op value". The
+// comparisons == and != compare numbers if both values are numbers and strings
+// otherwise. <, <=, > and >= compare numbers: An error is returned if value or
+// a non-empty entry is not a number, empty entries never match. Numbers are
+// parsed with ParseDecimal and the given locale. "contains", "prefix" and
+// "suffix" test for substrings and "matches" matches the entry against the
+// regular expression value.
+func (c *Collection) Where(key, op, value string, loc *Locale) (*Collection, error) {
+	if !c.hasKey(key) {
+		return nil, NewColKeyError("invalid key: %s, allowed keys are %s", key, strings.Join(c.Head, ", "))
+	}
+	var test func(entry string) bool
+	// numeric is the test for the comparisons of numbers, the result of Cmp
+	var numeric func(cmp int) bool
+	switch op {
+	case "==", "=":
+		test = func(entry string) bool { return compareValues(entry, value, loc) == 0 }
+	case "!=":
+		test = func(entry string) bool { return compareValues(entry, value, loc) != 0 }
+	case "<":
+		numeric = func(cmp int) bool { return cmp < 0 }
+	case "<=":
+		numeric = func(cmp int) bool { return cmp <= 0 }
+	case ">":
+		numeric = func(cmp int) bool { return cmp > 0 }
+	case ">=":
+		numeric = func(cmp int) bool { return cmp >= 0 }
+	case "contains":
+		test = func(entry string) bool { return strings.Contains(entry, value) }
+	case "prefix":
+		test = func(entry string) bool { return strings.HasPrefix(entry, value) }
+	case "suffix":
+		test = func(entry string) bool { return strings.HasSuffix(entry, value) }
+	case "matches":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, err
+		}
+		test = re.MatchString
+	default:
+		return nil, fmt.Errorf("invalid operator \"%s\": Must be one of %s", op, strings.Join(WhereOperators, ", "))
+	}
+	if numeric == nil {
+		return c.Filter(func(col *Column) bool {
+			entry := col.GetKey(key)
+			return entry != NoColEntry && test(entry)
+		}), nil
+	}
+	d, err := ParseDecimal(value, loc)
+	if err != nil {
+		return nil, fmt.Errorf("operator \"%s\" compares numbers: %w", op, err)
+	}
+	cols := make([]*Column, 0, len(c.Columns))
+	for i, col := range c.Columns {
+		entry := col.GetKey(key)
+		if entry == NoColEntry || strings.TrimSpace(entry) == "" {
+			continue
+		}
+		entryDecimal, err := ParseDecimal(entry, loc)
+		if err != nil {
+			return nil, fmt.Errorf("entry \"%s\" of column %d: %w", key, i+1, err)
+		}
+		if numeric(entryDecimal.Rat().Cmp(d.Rat())) {
+			cols = append(cols, col)
+		}
+	}
+	return &Collection{c.Head, cols}, nil
+}
+
+// SortMode describes how entries are compared when sorting.
+type SortMode int
+
+const (
+	// SortLexical compares entries as strings.
+	SortLexical SortMode = iota
+	// SortNumeric compares entries as numbers, empty entries are sorted last.
+	SortNumeric
+	// SortNatural compares strings but sequences of digits as numbers, for
+	// example "file2" comes before "file10".
+	SortNatural
+)
+
+func (mode SortMode) String() string {
+	switch mode {
+	case SortLexical:
+		return "lexical"
+	case SortNumeric:
+		return "numeric"
+	case SortNatural:
+		return "natural"
+	default:
+		return fmt.Sprintf("SortMode(%d)", int(mode))
+	}
+}
+
+// SortKey is a key for SortBy.
+type SortKey struct {
+	Key        string
+	Mode       SortMode
+	Descending bool
+}
+
+// ParseSortKey parses a key in the form "key[:mode][:order]" where mode is
+// "lexical" (the default), "numeric" or "natural" and order is "asc" (the
+// default) or "desc".
+// Example: "price:numeric:desc".
+func ParseSortKey(s string) (SortKey, error) {
+	parts := strings.Split(s, ":")
+	res := SortKey{Key: parts[0]}
+	for _, part := range parts[1:] {
+		switch strings.ToLower(part) {
+		case "lexical":
+			res.Mode = SortLexical
+		case "numeric":
+			res.Mode = SortNumeric
+		case "natural":
+			res.Mode = SortNatural
+		case "asc":
+			res.Descending = false
+		case "desc":
+			res.Descending = true
+		default:
+			return SortKey{}, fmt.Errorf("invalid sort key \"%s\": Unknown option \"%s\"", s, part)
+		}
+	}
+	return res, nil
+}
+
+// naturalCompare compares a and b, sequences of digits are compared as numbers.
+func naturalCompare(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	i, j := 0, 0
+	for i < len(ra) && j < len(rb) {
+		if unicode.IsDigit(ra[i]) && unicode.IsDigit(rb[j]) {
+			si, sj := i, j
+			for i < len(ra) && unicode.IsDigit(ra[i]) {
+				i++
+			}
+			for j < len(rb) && unicode.IsDigit(rb[j]) {
+				j++
+			}
+			na := strings.TrimLeft(string(ra[si:i]), "0")
+			nb := strings.TrimLeft(string(rb[sj:j]), "0")
+			if len(na) != len(nb) {
+				if len(na) < len(nb) {
+					return -1
+				}
+				return 1
+			}
+			if cmp := strings.Compare(na, nb); cmp != 0 {
+				return cmp
+			}
+			continue
+		}
+		if ra[i] != rb[j] {
+			if ra[i] < rb[j] {
+				return -1
+			}
+			return 1
+		}
+		i++
+		j++
+	}
+	switch {
+	case i < len(ra):
+		return 1
+	case j < len(rb):
+		return -1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+// SortBy returns a new collection with the columns sorted by the given keys.
+// Columns that are equal with respect to the first key are sorted by the
+// second key and so on, the sort is stable. Numeric keys are parsed with
+// ParseDecimal and the given locale, an error is returned if a non-empty entry
+// is not a number.
+func (c *Collection) SortBy(loc *Locale, keys ...SortKey) (*Collection, error) {
+	// compute the numbers in advance
+	numbers := make([]map[*Column]Decimal, len(keys))
+	for i, key := range keys {
+		if !c.hasKey(key.Key) {
+			return nil, NewColKeyError("invalid key: %s, allowed keys are %s", key.Key, strings.Join(c.Head, ", "))
+		}
+		if key.Mode != SortNumeric {
+			continue
+		}
+		numbers[i] = make(map[*Column]Decimal, len(c.Columns))
+		for j, col := range c.Columns {
+			entry := col.GetKey(key.Key)
+			if entry == NoColEntry || strings.TrimSpace(entry) == "" {
+				continue
+			}
+			d, err := ParseDecimal(entry, loc)
+			if err != nil {
+				return nil, fmt.Errorf("entry \"%s\" of column %d: %w", key.Key, j+1, err)
+			}
+			numbers[i][col] = d
+		}
+	}
+	compare := func(a, b *Column) int {
+		for i, key := range keys {
+			var cmp int
+			switch key.Mode {
+			case SortNumeric:
+				da, hasA := numbers[i][a]
+				db, hasB := numbers[i][b]
+				switch {
+				case hasA && hasB:
+					cmp = da.Rat().Cmp(db.Rat())
+				case hasA:
+					// empty entries last, independent of the order
+					cmp = -1
+				case hasB:
+					cmp = 1
+				}
+				if hasA && hasB && key.Descending {
+					cmp = -cmp
+				}
+			case SortNatural:
+				cmp = naturalCompare(a.GetKey(key.Key), b.GetKey(key.Key))
+			default:
+				cmp = strings.Compare(a.GetKey(key.Key), b.GetKey(key.Key))
+			}
+			if key.Mode != SortNumeric && key.Descending {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp
+			}
+		}
+		return 0
+	}
+	cols := make([]*Column, len(c.Columns))
+	copy(cols, c.Columns)
+	sort.SliceStable(cols, func(i, j int) bool {
+		return compare(cols[i], cols[j]) < 0
+	})
+	return &Collection{c.Head, cols}, nil
+}
+
+// Group is a sub-collection of a collection with all columns that have the
+// same entry (Name) for a row name, see GroupBy.
+type Group struct {
+	*Collection
+	Name string
+}
+
+// GroupBy splits the collection into groups of columns with the same entry for
+// the given row name. The groups are ordered by the first occurrence of the
+// entry.
+func (c *Collection) GroupBy(key string) ([]*Group, error) {
+	if !c.hasKey(key) {
+		return nil, NewColKeyError("invalid key: %s, allowed keys are %s", key, strings.Join(c.Head, ", "))
+	}
+	var res []*Group
+	groups := make(map[string]*Group)
+	for _, col := range c.Columns {
+		name := col.GetKey(key)
+		if name == NoColEntry {
+			name = ""
+		}
+		group, has := groups[name]
+		if !has {
+			group = &Group{&Collection{c.Head, nil}, name}
+			groups[name] = group
+			res = append(res, group)
+		}
+		group.Columns = append(group.Columns, col)
+	}
+	return res, nil
+}
+
+// Chunk is a part of a collection with at most n columns, see
+// Collection.Chunk.
+type Chunk struct {
+	*Collection
+	// Index is the position of the chunk (starting with 0).
+	Index int
+	// Total is the number of chunks.
+	Total int
+}
+
+// Number returns the position of the chunk starting with 1.
+func (c *Chunk) Number() int {
+	return c.Index + 1
+}
+
+// IsFirst returns true if c is the first chunk.
+func (c *Chunk) IsFirst() bool {
+	return c.Index == 0
+}
+
+// IsLast returns true if c is the last chunk.
+func (c *Chunk) IsLast() bool {
+	return c.Index == c.Total-1
+}
+
+// Chunk splits the collection into chunks of n columns, the last chunk may
+// contain less columns. An empty collection has no chunks. An error is
+// returned if n < 1.
+func (c *Collection) Chunk(n int) ([]*Chunk, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("chunk size must be >= 1, got %d", n)
+	}
+	total := (len(c.Columns) + n - 1) / n
+	res := make([]*Chunk, total)
+	for i := range res {
+		end := IntMin((i+1)*n, len(c.Columns))
+		res[i] = &Chunk{&Collection{c.Head, c.Columns[i*n : end]}, i, total}
+	}
+	return res, nil
+}
+
+// Distinct returns a new collection that contains only the first column for
+// each combination of entries for the given row names. If no keys are given all
+// row names are used.
+func (c *Collection) Distinct(keys ...string) (*Collection, error) {
+	if len(keys) == 0 {
+		keys = c.Head
+	}
+	for _, key := range keys {
+		if !c.hasKey(key) {
+			return nil, NewColKeyError("invalid key: %s, allowed keys are %s", key, strings.Join(c.Head, ", "))
+		}
+	}
+	seen := make(map[string]struct{}, len(c.Columns))
+	return c.Filter(func(col *Column) bool {
+		values := make([]string, len(keys))
+		for i, key := range keys {
+			values[i] = col.GetKey(key)
+		}
+		// use a separator that is very unlikely to appear in entries
+		id := strings.Join(values, "\x00")
+		if _, has := seen[id]; has {
+			return false
+		}
+		seen[id] = struct{}{}
+		return true
+	}), nil
+}
+
+// toCollection returns the collection of a *Collection, *Group or *Chunk. The
+// second return value is false for all other values.
+func toCollection(arg interface{}) (*Collection, bool) {
+	switch v := arg.(type) {
+	case *Collection:
+		return v, true
+	case *Group:
+		return v.Collection, true
+	case *Chunk:
+		return v.Collection, true
+	default:
+		return nil, false
+	}
+}
+
+// collectionArgs splits the arguments of a template function: The last
+// argument must be a collection (so the function can be used in pipelines),
+// all other arguments are returned as strings.
+func collectionArgs(name string, args []interface{}) ([]string, *Collection, error) {
+	if len(args) == 0 {
+		return nil, nil, fmt.Errorf("%s expects a collection as last argument", name)
+	}
+	c, ok := toCollection(args[len(args)-1])
+	if !ok {
+		return nil, nil, fmt.Errorf("%s expects a collection as last argument, got %T", name, args[len(args)-1])
+	}
+	strs := make([]string, len(args)-1)
+	for i, arg := range args[:len(args)-1] {
+		strs[i] = plainString(arg)
+	}
+	return strs, c, nil
+}
+
+// Where is the template function "where", it calls Collection.Where with the
+// locale of f. The arguments are key, value and collection (operator ==) or
+// key, operator, value and collection.
+// The result is a collection, range over its Columns.
+// Example: #(range (where "price" ">" "10" .data).Columns#)#(.Map.name#)#(end#).
+func (f *NumberFormat) Where(args ...interface{}) (*Collection, error) {
+	strs, c, err := collectionArgs("where", args)
+	if err != nil {
+		return nil, err
+	}
+	switch len(strs) {
+	case 2:
+		return c.Where(strs[0], "==", strs[1], f.Locale)
+	case 3:
+		return c.Where(strs[0], strs[1], strs[2], f.Locale)
+	default:
+		return nil, fmt.Errorf("where expects 3 or 4 arguments, got %d", len(args))
+	}
+}
+
+// SortBy is the template function "sortBy", it calls Collection.SortBy with
+// the locale of f. The arguments are the keys (see ParseSortKey) followed by
+// the collection.
+// Example: #(range (sortBy "price:numeric:desc" "name" .data).Columns#)...#(end#).
+func (f *NumberFormat) SortBy(args ...interface{}) (*Collection, error) {
+	strs, c, err := collectionArgs("sortBy", args)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]SortKey, len(strs))
+	for i, s := range strs {
+		if keys[i], err = ParseSortKey(s); err != nil {
+			return nil, err
+		}
+	}
+	return c.SortBy(f.Locale, keys...)
+}
+
+// GroupByFunc is the template function "groupBy", it calls
+// Collection.GroupBy. The arguments are the row name and a collection, group or
+// chunk, so groups can be grouped again.
+// Example: #(range groupBy "category" .data#)#(.Name#): #(len .Columns#)#(end#).
+func GroupByFunc(args ...interface{}) ([]*Group, error) {
+	strs, c, err := collectionArgs("groupBy", args)
+	if err != nil {
+		return nil, err
+	}
+	if len(strs) != 1 {
+		return nil, fmt.Errorf("groupBy expects 2 arguments, got %d", len(args))
+	}
+	return c.GroupBy(strs[0])
+}
+
+// DistinctFunc is the template function "distinct". The arguments are the row
+// names followed by the collection.
+// Example: #(range (distinct "category" .data).Columns#)...#(end#).
+func DistinctFunc(args ...interface{}) (*Collection, error) {
+	strs, c, err := collectionArgs("distinct", args)
+	if err != nil {
+		return nil, err
+	}
+	return c.Distinct(strs...)
+}
+
+// ChunkFunc is the template function "chunk", it calls Collection.Chunk. The
+// arguments are the chunk size and a collection, group or chunk.
+// Example:
+//
+//	#(range chunk 20 .data#)
+//	#(table .Collection#)
+//	#(if not .IsLast#)\newpage#(end#)
+//	#(end#)
+func ChunkFunc(n int, args ...interface{}) ([]*Chunk, error) {
+	strs, c, err := collectionArgs("chunk", args)
+	if err != nil {
+		return nil, err
+	}
+	if len(strs) != 0 {
+		return nil, fmt.Errorf("chunk expects 2 arguments, got %d", len(args)+1)
+	}
+	return c.Chunk(n)
+}
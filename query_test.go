@@ -0,0 +1,129 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import "testing"
+
+func TestQueryFuncs(t *testing.T) {
+	data := map[string]interface{}{"data": productCollection(t)}
+	tests := []struct {
+		name, template, expected string
+	}{
+		{"where", `#(range (where "price" ">" "2" .data).Columns#)#(.Map.name#);#(end#)`, "pear;bread;"},
+		{"where equal", `#(range (where "cat" "fruit" .data).Columns#)#(.Map.name#);#(end#)`, "apple;pear;"},
+		{"sortBy", `#(range (sortBy "price:numeric:desc" "name" .data).Columns#)#(.Map.name#);#(end#)`, "bread;pear;apple;roll;"},
+		{"pipeline", `#(range (.data | where "cat" "fruit" | sortBy "name:desc").Columns#)#(.Map.name#);#(end#)`, "pear;apple;"},
+		{"distinct", `#(range (distinct "cat" .data).Columns#)#(.Map.cat#);#(end#)`, "fruit;bakery;"},
+		{"groupBy", `#(range groupBy "cat" .data#)#(.Name#): #(len .Columns#);#(end#)`, "fruit: 2;bakery: 2;"},
+		{"nested groupBy", `#(range groupBy "cat" .data#)#(range groupBy "name" .#)#(.Name#);#(end#)#(end#)`, "apple;pear;bread;roll;"},
+		{"where on group", `#(range groupBy "cat" .data#)#(len (where "price" ">" "2" .).Columns#)#(end#)`, "11"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := executeTemplate(&TemplateOptions{}, data, test.template)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestQueryLocale(t *testing.T) {
+	data := map[string]interface{}{"data": testCollection(t, []string{"name", "p"},
+		[]string{"a", "1.234,50"},
+		[]string{"b", "2,10"},
+		[]string{"c", "3,5"},
+		[]string{"d", ""},
+	)}
+	opts := &TemplateOptions{Numbers: NumberFormat{Locale: GermanLocale}}
+	tests := []struct {
+		name, template, expected string
+	}{
+		{"sortBy", `#(range (sortBy "p:numeric" .data).Columns#)#(.Map.name#);#(end#)`, "b;c;a;d;"},
+		{"sortBy desc", `#(range (sortBy "p:numeric:desc" .data).Columns#)#(.Map.name#);#(end#)`, "a;c;b;d;"},
+		{"where", `#(range (where "p" ">" "3" .data).Columns#)#(.Map.name#);#(end#)`, "a;c;"},
+		{"where decimal comma", `#(range (where "p" "<=" "3,5" .data).Columns#)#(.Map.name#);#(end#)`, "b;c;"},
+		{"where equal", `#(range (where "p" "2,1" .data).Columns#)#(.Map.name#);#(end#)`, "b;"},
+		{"where equal grouping", `#(range (where "p" "==" "1234,5" .data).Columns#)#(.Map.name#);#(end#)`, "a;"},
+		{"sum", `#(sum "p" .data#)`, "1240.10"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := executeTemplate(opts, data, test.template)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+	// the English locale can't parse the entries
+	for _, template := range []string{
+		`#(sortBy "p:numeric" .data#)`,
+		`#(where "p" ">" "3" .data#)`,
+	} {
+		if got, err := executeTemplate(&TemplateOptions{}, data, template); err == nil {
+			t.Errorf("%s: expected an error, got %q", template, got)
+		}
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	data := map[string]interface{}{"data": productCollection(t)}
+	for _, template := range []string{
+		`#(where "foo" "x" .data#)`,
+		`#(where "price" "~" "2" .data#)`,
+		`#(where "price" ">" "two" .data#)`,
+		`#(where "name" "<" "b" .data#)`,
+		`#(sortBy "price:foo" .data#)`,
+		`#(groupBy "cat"#)`,
+		`#(groupBy "cat" "name" .data#)`,
+		`#(distinct "foo" .data#)`,
+	} {
+		if got, err := executeTemplate(&TemplateOptions{}, data, template); err == nil {
+			t.Errorf("%s: expected an error, got %q", template, got)
+		}
+	}
+}
+
+func TestChunkFunc(t *testing.T) {
+	data := map[string]interface{}{"data": productCollection(t)}
+	tests := []struct {
+		name, template, expected string
+	}{
+		{"chunk", `#(range chunk 3 .data#)#(.Number#)/#(.Total#):#(len .Columns#)#(if not .IsLast#);#(end#)#(end#)`, "1/2:3;2/2:1"},
+		{"chunk group", `#(range groupBy "cat" .data#)#(range chunk 1 .#)#(.Number#)#(end#);#(end#)`, "12;12;"},
+		{"chunk chunk", `#(range chunk 2 .data#)#(len (chunk 1 .)#)#(end#)`, "22"},
+		{"empty", `#(len (chunk 2 (where "cat" "none" .data))#)`, "0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := executeTemplate(&TemplateOptions{}, data, test.template)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+	if got, err := executeTemplate(&TemplateOptions{}, data, `#(chunk 0 .data#)`); err == nil {
+		t.Errorf("expected an error for chunk size 0, got %q", got)
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// rawBlock is the position of a raw block in a template. start is the
+// position of the opening tag, contentStart the position after the opening
+// tag, contentEnd the position of the closing tag and end the position after
+// the closing tag.
+type rawBlock struct {
+	start, contentStart, contentEnd, end int
+}
+
+// rawTag returns a regular expression that matches the tag with the given
+// name, for example #(raw#). Spaces are allowed around the name.
+func rawTag(name, delimLeft, delimRight string) *regexp.Regexp {
+	return regexp.MustCompile(regexp.QuoteMeta(delimLeft) + `\s*` + name + `\s*` + regexp.QuoteMeta(delimRight))
+}
+
+// findRawBlocks returns all raw blocks in text.
+func findRawBlocks(text, delimLeft, delimRight string) ([]rawBlock, error) {
+	begin := rawTag("raw", delimLeft, delimRight)
+	end := rawTag("endraw", delimLeft, delimRight)
+	var res []rawBlock
+	pos := 0
+	for {
+		loc := begin.FindStringIndex(text[pos:])
+		if loc == nil {
+			return res, nil
+		}
+		block := rawBlock{start: pos + loc[0], contentStart: pos + loc[1]}
+		endLoc := end.FindStringIndex(text[block.contentStart:])
+		if endLoc == nil {
+			line := 1 + strings.Count(text[:block.start], "\n")
+			return nil, fmt.Errorf("line %d: raw block is not closed with %sendraw%s", line, delimLeft, delimRight)
+		}
+		block.contentEnd = block.contentStart + endLoc[0]
+		block.end = block.contentStart + endLoc[1]
+		res = append(res, block)
+		pos = block.end
+	}
+}
+
+// PreprocessRawBlocks replaces all raw blocks in text. A raw block starts with
+// #(raw#) and ends with #(endraw#) (given the delimiters #( and #)), its content
+// is written to the output without any changes. Template actions in a raw block
+// are not executed and the content is never escaped.
+//
+// Each block is replaced by an action that calls the "raw" function with the
+// content as string constant. This way line numbers in error messages don't
+// change.
+//
+// A single delimiter can also be written as #(raw "#("#).
+func PreprocessRawBlocks(text, delimLeft, delimRight string) (string, error) {
+	blocks, err := findRawBlocks(text, delimLeft, delimRight)
+	if err != nil {
+		return "", err
+	}
+	if len(blocks) == 0 {
+		return text, nil
+	}
+	var b strings.Builder
+	b.Grow(len(text))
+	pos := 0
+	for _, block := range blocks {
+		b.WriteString(text[pos:block.start])
+		content := text[block.contentStart:block.contentEnd]
+		b.WriteString(delimLeft + "raw " + strconv.Quote(content) + delimRight)
+		// keep line numbers with a comment containing the line breaks
+		if lines := strings.Count(text[block.start:block.end], "\n"); lines > 0 {
+			b.WriteString(delimLeft + "/*" + strings.Repeat("\n", lines) + "*/" + delimRight)
+		}
+		pos = block.end
+	}
+	b.WriteString(text[pos:])
+	return b.String(), nil
+}
+
+// TemplateWarning is a diagnostic message for a template that is not an error
+// but might be one.
+type TemplateWarning struct {
+	Name    string
+	Line    int
+	Message string
+}
+
+func (w TemplateWarning) String() string {
+	return fmt.Sprintf("%s:%d: %s", w.Name, w.Line, w.Message)
+}
+
+// macroDefinition matches the commands that define macros.
+var macroDefinition = regexp.MustCompile(`\\(?:[gex]?def|(?:re)?newcommand\*?|providecommand\*?)`)
+
+// skipBraces returns the position after the group that starts at i (text[i]
+// must be {) or -1 if the group is not closed.
+func skipBraces(text string, i int) int {
+	depth := 0
+	for j := i; j < len(text); j++ {
+		switch text[j] {
+		case '\\':
+			j++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return -1
+}
+
+// macroBody returns the position of the body of a macro definition, the
+// command (for example \def) ends at i. It returns -1 if the definition can't
+// be parsed.
+func macroBody(text string, i int, isDef bool) (int, int) {
+	i = skipSpaces(text, i)
+	if i >= len(text) {
+		return -1, -1
+	}
+	// skip the name of the macro
+	switch {
+	case text[i] == '\\':
+		_, i = readCommandName(text, i)
+	case text[i] == '{' && !isDef:
+		i = skipBraces(text, i)
+	default:
+		return -1, -1
+	}
+	if i < 0 {
+		return -1, -1
+	}
+	if isDef {
+		// parameter text until the body
+		for i < len(text) && text[i] != '{' {
+			i++
+		}
+	} else {
+		// optional arguments
+		for {
+			i = skipSpaces(text, i)
+			if i >= len(text) || text[i] != '[' {
+				break
+			}
+			closing := strings.IndexByte(text[i:], ']')
+			if closing < 0 {
+				return -1, -1
+			}
+			i += closing + 1
+		}
+	}
+	if i >= len(text) || text[i] != '{' {
+		return -1, -1
+	}
+	return i, skipBraces(text, i)
+}
+
+// CheckMacroDelimiters looks for suspicious template delimiters in the
+// definitions of LaTeX macros (\def, \newcommand and similar). In LaTeX # is
+// used for macro parameters, so for example \def\x#1(... can easily contain
+// the delimiter #( by accident.
+//
+// A left delimiter is reported if it occurs in the parameter text of a \def,
+// if it is directly preceded by # or if there is no right delimiter before the
+// end of the macro body. Raw blocks are ignored. name is used in the returned
+// warnings.
+func CheckMacroDelimiters(name, text, delimLeft, delimRight string) []TemplateWarning {
+	blocks, _ := findRawBlocks(text, delimLeft, delimRight)
+	// mask raw blocks, keep positions and line breaks
+	masked := []byte(text)
+	for _, block := range blocks {
+		for j := block.start; j < block.end; j++ {
+			if masked[j] != '\n' {
+				masked[j] = ' '
+			}
+		}
+	}
+	text = string(masked)
+	var res []TemplateWarning
+	warn := func(pos int, format string, a ...interface{}) {
+		res = append(res, TemplateWarning{
+			Name:    name,
+			Line:    1 + strings.Count(text[:pos], "\n"),
+			Message: fmt.Sprintf(format, a...),
+		})
+	}
+	hint := fmt.Sprintf("use %sraw%s...%sendraw%s if it should be written literally",
+		delimLeft, delimRight, delimLeft, delimRight)
+	for _, loc := range macroDefinition.FindAllStringIndex(text, -1) {
+		isDef := strings.HasSuffix(text[loc[0]:loc[1]], "def")
+		bodyStart, bodyEnd := macroBody(text, loc[1], isDef)
+		if bodyStart < 0 || bodyEnd < 0 {
+			continue
+		}
+		command := text[loc[0]:loc[1]]
+		for pos := loc[1]; pos < bodyEnd; {
+			i := strings.Index(text[pos:bodyEnd], delimLeft)
+			if i < 0 {
+				break
+			}
+			p := pos + i
+			switch {
+			case p < bodyStart:
+				warn(p, "template delimiter %s in the parameter text of %s, %s", delimLeft, command, hint)
+			case p > 0 && text[p-1] == '#':
+				warn(p, "template delimiter %s directly after # in the body of %s, %s", delimLeft, command, hint)
+			case !strings.Contains(text[p+len(delimLeft):bodyEnd], delimRight):
+				warn(p, "template delimiter %s is not closed in the body of %s, %s", delimLeft, command, hint)
+			}
+			pos = p + len(delimLeft)
+		}
+	}
+	return res
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRawBlocks(t *testing.T) {
+	tests := []struct {
+		name, template, expected string
+	}{
+		{"raw", `a #(raw#)#(.X#) & \def\x#1{}#(endraw#) b`, `a #(.X#) & \def\x#1{} b`},
+		{"spaces", `#( raw #)#(.X#)#(  endraw#)`, `#(.X#)`},
+		{"several", `#(raw#)#(#)#(endraw#) #(.X#) #(raw#)#(endraw#)`, `#(#) a\&b `},
+		{"multiple lines", "#(raw#)a\n#(.X#)\n#(endraw#)\n#(.X#)", "a\n#(.X#)\n\na\\&b"},
+		{"nested", `#(raw#)a #(raw#) b#(endraw#)`, `a #(raw#) b`},
+		{"delimiter", `#(raw "#("#).X#(raw "#)"#)`, `#(.X#)`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := executeTemplate(autoEscapeOptions(), map[string]string{"X": "a&b"}, test.template)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+	for _, template := range []string{
+		"#(raw#)a",
+		"a\n#(raw#)b#(endraw#)#(raw#)c",
+		// raw blocks can't be nested, the first #(endraw#) ends the block
+		"#(raw#)a #(raw#) b#(endraw#) c#(endraw#)",
+	} {
+		if got, err := executeTemplate(autoEscapeOptions(), nil, template); err == nil {
+			t.Errorf("%q: expected an error, got %q", template, got)
+		}
+	}
+}
+
+func TestPreprocessRawBlocksLines(t *testing.T) {
+	text := "a\n#(raw#)b\n\nc#(endraw#) d\n#(end#)"
+	processed, err := PreprocessRawBlocks(text, "#(", "#)")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, expected := strings.Count(processed, "\n"), strings.Count(text, "\n"); got != expected {
+		t.Errorf("expected %d line breaks, got %d in %q", expected, got, processed)
+	}
+	_, err = executeTemplate(&TemplateOptions{}, nil, text)
+	if err == nil || !strings.Contains(err.Error(), "t0.tex:5:") {
+		t.Errorf("expected an error in line 5, got %v", err)
+	}
+	_, err = PreprocessRawBlocks("a\n\n#(raw#)b", "#(", "#)")
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("expected an error in line 3, got %v", err)
+	}
+	if got, err := PreprocessRawBlocks("[[raw]]{{x}}[[endraw]]", "[[", "]]"); err != nil || got != `[[raw "{{x}}"]]` {
+		t.Errorf("custom delimiters: got %q, %v", got, err)
+	}
+}
+
+func TestCheckMacroDelimiters(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []int
+	}{
+		{`\def\x#1#(a#){#1}`, []int{1}},
+		{`\gdef\x#1#(#){}`, []int{1}},
+		{"a\n" + `\newcommand{\y}[1]{##(#1}`, []int{2}},
+		{`\newcommand*{\y}{#(a}`, []int{1}},
+		{`\providecommand{\y}{` + "\n" + `#(a}`, []int{2}},
+		{`\renewcommand\y[1][x]{#(.A#)}`, nil},
+		{`\def\x{#raw}`, nil},
+		{`#(raw#)\def\x#1#(a#){}#(endraw#)`, nil},
+		{`\newcommand{\y}{a} #(.A`, nil},
+		{`\def\x#1#(a#){#1} \newcommand{\y}{#(a}`, []int{1, 1}},
+	}
+	for _, test := range tests {
+		var lines []int
+		for _, w := range CheckMacroDelimiters("t.tex", test.text, "#(", "#)") {
+			if w.Name != "t.tex" || !strings.Contains(w.Message, "#(raw#)...#(endraw#)") {
+				t.Errorf("%q: unexpected warning %s", test.text, w)
+			}
+			lines = append(lines, w.Line)
+		}
+		if !reflect.DeepEqual(lines, test.expected) {
+			t.Errorf("%q: expected warnings in lines %v, got %v", test.text, test.expected, lines)
+		}
+	}
+}
+
+func TestTemplateWarnings(t *testing.T) {
+	var warnings []string
+	opts := &TemplateOptions{Warn: func(w TemplateWarning) {
+		warnings = append(warnings, w.String())
+	}}
+	if _, err := executeTemplate(opts, nil, "a\n"+`\newcommand{\y}[1]{##(1#)}`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{`t0.tex:2: template delimiter #( directly after # in the body of \newcommand, use #(raw#)...#(endraw#) if it should be written literally`}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("expected %q, got %q", expected, warnings)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// QuoteStyle describes how straight quotes are converted by SmartText.
+type QuoteStyle int
+
+const (
+	// EnglishQuotes converts "quoted" to ``quoted'' and 'quoted' to `quoted'.
+	EnglishQuotes QuoteStyle = iota
+	// GermanQuotes converts "quoted" to \glqq{}quoted\grqq{} and 'quoted' to
+	// \glq{}quoted\grq{} (requires babel with ngerman).
+	GermanQuotes
+	// CSQuotes converts "quoted" to \enquote{quoted} and 'quoted' to
+	// \enquote*{quoted} (requires csquotes).
+	CSQuotes
+)
+
+func (style QuoteStyle) String() string {
+	switch style {
+	case EnglishQuotes:
+		return "english"
+	case GermanQuotes:
+		return "german"
+	case CSQuotes:
+		return "csquotes"
+	default:
+		return fmt.Sprintf("QuoteStyle(%d)", int(style))
+	}
+}
+
+// ParseQuoteStyle parses a quote style from its name, the names are
+// "english", "german" and "csquotes".
+func ParseQuoteStyle(s string) (QuoteStyle, error) {
+	switch strings.ToLower(s) {
+	case "english", "en":
+		return EnglishQuotes, nil
+	case "german", "de", "ngerman":
+		return GermanQuotes, nil
+	case "csquotes", "enquote":
+		return CSQuotes, nil
+	default:
+		return EnglishQuotes, fmt.Errorf("invalid quote style \"%s\": Must be english, german or csquotes", s)
+	}
+}
+
+// quoteStrings returns the LaTeX code for opening and closing double and single
+// quotes.
+func (style QuoteStyle) quoteStrings() (openDouble, closeDouble, openSingle, closeSingle string) {
+	switch style {
+	case GermanQuotes:
+		return `\glqq{}`, `\grqq{}`, `\glq{}`, `\grq{}`
+	case CSQuotes:
+		return `\enquote{`, `}`, `\enquote*{`, `}`
+	default:
+		return "``", "''", "`", "'"
+	}
+}
+
+// isOpeningPosition returns true if a quote after prev opens a quotation.
+func isOpeningPosition(prev rune) bool {
+	return prev == 0 || unicode.IsSpace(prev) || strings.ContainsRune("([{-~", prev)
+}
+
+// Elisions are words that start with an apostrophe (the apostrophe is
+// omitted), for example 'tis. "n'" matches 'n' as in rock 'n' roll.
+var Elisions = []string{"n'", "tis", "twas", "twere", "em", "til", "cause"}
+
+// elisionApostrophes returns the positions of the apostrophes that belong to
+// an element of Elisions (case insensitive). These are never quotes.
+func elisionApostrophes(runes []rune) map[int]bool {
+	res := make(map[int]bool)
+	for i, r := range runes {
+		if r != '\'' || (i > 0 && !isOpeningPosition(runes[i-1])) {
+			continue
+		}
+		for _, elision := range Elisions {
+			word := []rune(elision)
+			end := i + 1 + len(word)
+			if end > len(runes) || !strings.EqualFold(string(runes[i+1:end]), elision) {
+				continue
+			}
+			if end < len(runes) && unicode.IsLetter(runes[end]) {
+				continue
+			}
+			res[i] = true
+			if word[len(word)-1] == '\'' {
+				res[end-1] = true
+			}
+			break
+		}
+	}
+	return res
+}
+
+// matchQuotes returns the positions of opening and closing quotes (quote
+// being ' or ") in runes that form a pair. All other quotes are not in the map.
+// For ' a quote that is followed by a letter is never a closing quote, it is
+// an apostrophe. Positions in skip are ignored.
+func matchQuotes(runes []rune, quote rune, skip map[int]bool) map[int]bool {
+	res := make(map[int]bool)
+	var open []int
+	for i, r := range runes {
+		if r != quote || skip[i] {
+			continue
+		}
+		var prev, next rune
+		if i > 0 {
+			prev = runes[i-1]
+		}
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+		switch {
+		case isOpeningPosition(prev) && next != 0 && !unicode.IsSpace(next):
+			open = append(open, i)
+		case len(open) > 0 && !(quote == '\'' && unicode.IsLetter(next)):
+			res[open[len(open)-1]] = true
+			res[i] = false
+			open = open[:len(open)-1]
+		}
+	}
+	return res
+}
+
+// isNumberRange returns true if the hyphen at position i separates two numbers
+// as in 1-5. Sequences with more than one hyphen such as 2024-03-01 are not
+// considered a range.
+func isNumberRange(runes []rune, i int) bool {
+	start := i
+	for start > 0 && unicode.IsDigit(runes[start-1]) {
+		start--
+	}
+	end := i + 1
+	for end < len(runes) && unicode.IsDigit(runes[end]) {
+		end++
+	}
+	if start == i || end == i+1 {
+		return false
+	}
+	return (start == 0 || runes[start-1] != '-') && (end == len(runes) || runes[end] != '-')
+}
+
+// SmartText returns a function that converts typewriter text into typographic
+// LaTeX: quotes are converted as described by style, "..." becomes \dots{},
+// a hyphen between numbers (1-5) becomes an en dash (1--5) as does a hyphen
+// surrounded by spaces, and non-breaking spaces become ~.
+//
+// Quotes that don't form a pair are converted as in EnglishQuotes, this way
+// \enquote never produces unbalanced braces. A single quote that doesn't form
+// a pair or starts one of the Elisions is an apostrophe: 'tis and rock 'n'
+// roll keep their apostrophes.
+//
+// The returned function expects text that is already escaped, use
+// SmartTextEscaper to combine it with escaping.
+func SmartText(style QuoteStyle) LatexEscapeFunc {
+	openDouble, closeDouble, openSingle, closeSingle := style.quoteStrings()
+	return func(s string) string {
+		runes := []rune(s)
+		doubles := matchQuotes(runes, '"', nil)
+		singles := matchQuotes(runes, '\'', elisionApostrophes(runes))
+		var b strings.Builder
+		b.Grow(len(s))
+		for i := 0; i < len(runes); i++ {
+			r := runes[i]
+			var prev, next rune
+			if i > 0 {
+				prev = runes[i-1]
+			}
+			if i+1 < len(runes) {
+				next = runes[i+1]
+			}
+			switch r {
+			case '"':
+				opening, matched := doubles[i]
+				switch {
+				case matched && opening:
+					b.WriteString(openDouble)
+				case matched:
+					b.WriteString(closeDouble)
+				case isOpeningPosition(prev):
+					b.WriteString("``")
+				default:
+					b.WriteString("''")
+				}
+			case '\'':
+				opening, matched := singles[i]
+				switch {
+				case matched && opening:
+					b.WriteString(openSingle)
+				case matched:
+					b.WriteString(closeSingle)
+				default:
+					b.WriteRune('\'')
+				}
+			case '.':
+				if i+2 < len(runes) && runes[i+1] == '.' && runes[i+2] == '.' {
+					b.WriteString(`\dots{}`)
+					i += 2
+				} else {
+					b.WriteRune(r)
+				}
+			case '-':
+				switch {
+				case isNumberRange(runes, i):
+					b.WriteString("--")
+				case prev == ' ' && next == ' ':
+					b.WriteString("--")
+				default:
+					b.WriteRune(r)
+				}
+			case '\u00a0':
+				b.WriteRune('~')
+			default:
+				b.WriteRune(r)
+			}
+		}
+		return b.String()
+	}
+}
+
+// SmartTextEscaper returns a function that first escapes with replace (if not
+// nil) and then applies SmartText(style).
+func SmartTextEscaper(style QuoteStyle, replace LatexEscapeFunc) LatexEscapeFunc {
+	smart := SmartText(style)
+	return func(s string) string {
+		if replace != nil {
+			s = replace(s)
+		}
+		return smart(s)
+	}
+}
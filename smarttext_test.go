@@ -0,0 +1,47 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import "testing"
+
+func TestSmartText(t *testing.T) {
+	tests := []struct {
+		style        QuoteStyle
+		in, expected string
+	}{
+		{EnglishQuotes, `"quoted"`, "``quoted''"},
+		{EnglishQuotes, `'quoted'`, "`quoted'"},
+		{GermanQuotes, `"quoted" and 'single'`, `\glqq{}quoted\grqq{} and \glq{}single\grq{}`},
+		{CSQuotes, `"a 'b' c"`, `\enquote{a \enquote*{b} c}`},
+		{CSQuotes, `"unbalanced`, "``unbalanced"},
+		{EnglishQuotes, `don't`, `don't`},
+		{EnglishQuotes, `'tis`, `'tis`},
+		{EnglishQuotes, `'Twas the night`, `'Twas the night`},
+		{CSQuotes, `rock 'n' roll`, `rock 'n' roll`},
+		{CSQuotes, `'em and 'em'`, `'em and 'em'`},
+		{CSQuotes, `'n' and 'quoted'`, `'n' and \enquote*{quoted}`},
+		{EnglishQuotes, `say 'hello`, `say 'hello`},
+		{EnglishQuotes, `the '90s`, `the '90s`},
+		{EnglishQuotes, "wait...", `wait\dots{}`},
+		{EnglishQuotes, "1-5 and 2024-03-01", "1--5 and 2024-03-01"},
+		{EnglishQuotes, "a - b", "a -- b"},
+		{EnglishQuotes, "a\u00a0b", "a~b"},
+	}
+	for _, test := range tests {
+		if got := SmartText(test.style)(test.in); got != test.expected {
+			t.Errorf("SmartText(%s)(%q): expected %q, got %q", test.style, test.in, test.expected, got)
+		}
+	}
+}
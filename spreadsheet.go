@@ -0,0 +1,345 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// SpreadsheetOptions describes which part of a spreadsheet is read.
+type SpreadsheetOptions struct {
+	// Sheet is the name of the sheet or its number (starting with 1), the
+	// first sheet is used if it is empty.
+	Sheet string
+	// HeaderRow is the number of the row (starting with 1) that contains the
+	// head, all rows before it are skipped. If it is 0 there is no head.
+	HeaderRow int
+}
+
+// SpreadsheetReader implements CollectionSource by reading a sheet of a
+// spreadsheet (.xlsx or .ods). The entries are the displayed cell values, for
+// example formatted numbers and dates. Empty rows are skipped.
+type SpreadsheetReader struct {
+	HeadContent    []string
+	ColumnsContent [][]string
+}
+
+// newSpreadsheetReader returns a reader for the rows of a sheet.
+func newSpreadsheetReader(rows [][]string, opts SpreadsheetOptions) (*SpreadsheetReader, error) {
+	if opts.HeaderRow < 0 {
+		return nil, fmt.Errorf("invalid header row %d: Must be >= 0", opts.HeaderRow)
+	}
+	var head []string
+	if opts.HeaderRow > 0 {
+		if opts.HeaderRow > len(rows) {
+			return nil, fmt.Errorf("can't read head from row %d, sheet contains only %d rows", opts.HeaderRow, len(rows))
+		}
+		head = rows[opts.HeaderRow-1]
+		rows = rows[opts.HeaderRow:]
+	}
+	var columns [][]string
+	for _, row := range rows {
+		if !isEmptyRow(row) {
+			columns = append(columns, row)
+		}
+	}
+	return &SpreadsheetReader{
+			HeadContent:    head,
+			ColumnsContent: columns,
+		},
+		nil
+}
+
+// isEmptyRow returns true if all cells of the row are empty.
+func isEmptyRow(row []string) bool {
+	for _, cell := range row {
+		if cell != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// selectSheet returns the position of the sheet in names, see
+// SpreadsheetOptions.Sheet.
+func selectSheet(names []string, sheet string) (int, error) {
+	if len(names) == 0 {
+		return -1, errors.New("spreadsheet doesn't contain any sheets")
+	}
+	if sheet == "" {
+		return 0, nil
+	}
+	for i, name := range names {
+		if name == sheet {
+			return i, nil
+		}
+	}
+	if n, err := strconv.Atoi(sheet); err == nil && n >= 1 && n <= len(names) {
+		return n - 1, nil
+	}
+	return -1, fmt.Errorf("invalid sheet \"%s\": Must be one of %s or a number between 1 and %d",
+		sheet, strings.Join(names, ", "), len(names))
+}
+
+// NewXLSXReader returns a new reader for an Excel (.xlsx) file.
+//
+// This function exhaustively reads all data from the reader in memory.
+func NewXLSXReader(r io.Reader, opts SpreadsheetOptions) (*SpreadsheetReader, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	names := f.GetSheetList()
+	i, err := selectSheet(names, opts.Sheet)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := f.GetRows(names[i])
+	if err != nil {
+		return nil, err
+	}
+	return newSpreadsheetReader(rows, opts)
+}
+
+// NewXLSXFileReader returns a new Excel reader given a file path.
+func NewXLSXFileReader(file string, opts SpreadsheetOptions) (*SpreadsheetReader, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	var reader *SpreadsheetReader
+	defer func() {
+		closeErr := f.Close()
+		if err == nil && closeErr != nil {
+			reader = nil
+			err = closeErr
+		}
+	}()
+	reader, err = NewXLSXReader(f, opts)
+	return reader, err
+}
+
+// NewODSReader returns a new reader for an OpenDocument spreadsheet (.ods)
+// with the given size.
+func NewODSReader(r io.ReaderAt, size int64, opts SpreadsheetOptions) (*SpreadsheetReader, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	content, err := archive.Open("content.xml")
+	if err != nil {
+		return nil, fmt.Errorf("invalid ods file: %w", err)
+	}
+	defer content.Close()
+	sheets, err := readODSContent(content)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(sheets))
+	for i, sheet := range sheets {
+		names[i] = sheet.name
+	}
+	i, err := selectSheet(names, opts.Sheet)
+	if err != nil {
+		return nil, err
+	}
+	return newSpreadsheetReader(sheets[i].rows, opts)
+}
+
+// NewODSFileReader returns a new OpenDocument reader given a file path.
+func NewODSFileReader(file string, opts SpreadsheetOptions) (*SpreadsheetReader, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	var reader *SpreadsheetReader
+	defer func() {
+		closeErr := f.Close()
+		if err == nil && closeErr != nil {
+			reader = nil
+			err = closeErr
+		}
+	}()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	reader, err = NewODSReader(f, info.Size(), opts)
+	return reader, err
+}
+
+// odsSheet is a table from the content of an ods file.
+type odsSheet struct {
+	name string
+	rows [][]string
+}
+
+// odsRepeated returns the value of the repeat attribute with the given name,
+// 1 if it doesn't exist.
+func odsRepeated(attrs []xml.Attr, name string) int {
+	for _, attr := range attrs {
+		if attr.Name.Local == name {
+			if n, err := strconv.Atoi(attr.Value); err == nil && n > 0 {
+				return n
+			}
+		}
+	}
+	return 1
+}
+
+// readODSContent reads all tables from the content.xml of an ods file. The
+// displayed value of a cell is its text, paragraphs are separated by a line
+// break. Repeated empty cells and rows at the end of a row or table (used by
+// office programs to fill the sheet) are dropped.
+func readODSContent(r io.Reader) ([]odsSheet, error) {
+	dec := xml.NewDecoder(r)
+	var sheets []odsSheet
+	var sheet *odsSheet
+	var row []string
+	var cell strings.Builder
+	// emptyRows and emptyCells are the number of pending empty rows and
+	// cells, they're only added if something non-empty follows
+	var emptyRows, emptyCells, rowRepeat, cellRepeat, paragraphs int
+	// tables can be nested in cells, only top level tables are sheets;
+	// annotations (comments) are not part of the displayed value
+	var tableDepth, annotationDepth int
+	inCell := false
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "table":
+				tableDepth++
+				if tableDepth == 1 {
+					name := ""
+					for _, attr := range t.Attr {
+						if attr.Name.Local == "name" {
+							name = attr.Value
+						}
+					}
+					sheets = append(sheets, odsSheet{name: name})
+					sheet = &sheets[len(sheets)-1]
+					emptyRows = 0
+				}
+			case "annotation":
+				annotationDepth++
+			case "table-row":
+				if tableDepth != 1 {
+					continue
+				}
+				row, emptyCells = nil, 0
+				rowRepeat = odsRepeated(t.Attr, "number-rows-repeated")
+			case "table-cell", "covered-table-cell":
+				if tableDepth == 1 && !inCell {
+					inCell = true
+					cell.Reset()
+					paragraphs = 0
+					cellRepeat = odsRepeated(t.Attr, "number-columns-repeated")
+				}
+			case "p", "h":
+				if inCell && annotationDepth == 0 {
+					if paragraphs > 0 {
+						cell.WriteString("\n")
+					}
+					paragraphs++
+				}
+			case "s":
+				if inCell && annotationDepth == 0 {
+					cell.WriteString(strings.Repeat(" ", odsRepeated(t.Attr, "c")))
+				}
+			case "tab":
+				if inCell && annotationDepth == 0 {
+					cell.WriteString("\t")
+				}
+			case "line-break":
+				if inCell && annotationDepth == 0 {
+					cell.WriteString("\n")
+				}
+			}
+		case xml.CharData:
+			if inCell && paragraphs > 0 && annotationDepth == 0 {
+				cell.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "table":
+				tableDepth--
+				if tableDepth == 0 {
+					sheet = nil
+				}
+			case "annotation":
+				annotationDepth--
+			case "table-row":
+				if tableDepth != 1 {
+					continue
+				}
+				if len(row) == 0 {
+					emptyRows += rowRepeat
+					continue
+				}
+				for ; emptyRows > 0; emptyRows-- {
+					sheet.rows = append(sheet.rows, nil)
+				}
+				for i := 0; i < rowRepeat; i++ {
+					sheet.rows = append(sheet.rows, row)
+				}
+			case "table-cell", "covered-table-cell":
+				if !inCell || tableDepth != 1 {
+					continue
+				}
+				inCell = false
+				value := cell.String()
+				if value == "" {
+					emptyCells += cellRepeat
+					continue
+				}
+				for ; emptyCells > 0; emptyCells-- {
+					row = append(row, "")
+				}
+				for i := 0; i < cellRepeat; i++ {
+					row = append(row, value)
+				}
+			}
+		}
+	}
+	return sheets, nil
+}
+
+// Head returns the head.
+func (r *SpreadsheetReader) Head() ([]string, error) {
+	return r.HeadContent, nil
+}
+
+// Entries returns all columns.
+func (r *SpreadsheetReader) Entries() ([][]string, error) {
+	return r.ColumnsContent, nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// odsContent wraps the tables in the content.xml of an ods file.
+func odsContent(tables string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+	xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+	xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0">
+<office:body><office:spreadsheet>` + tables + `</office:spreadsheet></office:body>
+</office:document-content>`
+}
+
+// odsFile returns an ods file (a zip archive) with the given content.xml.
+func odsFile(t *testing.T, content string) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create("content.xml")
+	if err != nil {
+		t.Fatalf("can't create ods file: %v", err)
+	}
+	if _, err := f.Write([]byte(content)); err != nil {
+		t.Fatalf("can't create ods file: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("can't create ods file: %v", err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+const odsTestTables = `
+<table:table table:name="Products">
+	<table:table-row>
+		<table:table-cell><text:p>name</text:p></table:table-cell>
+		<table:table-cell><text:p>price</text:p></table:table-cell>
+	</table:table-row>
+	<table:table-row>
+		<table:table-cell><text:p>apple<text:s text:c="2"/>pie</text:p></table:table-cell>
+		<table:table-cell office:value-type="float" office:value="1.5"><text:p>1,50</text:p></table:table-cell>
+	</table:table-row>
+	<table:table-row>
+		<table:table-cell><text:p>line 1</text:p><text:p>line 2</text:p></table:table-cell>
+		<table:table-cell><office:annotation><text:p>a comment</text:p></office:annotation><text:p>2</text:p></table:table-cell>
+		<table:table-cell table:number-columns-repeated="1000"/>
+	</table:table-row>
+	<table:table-row table:number-rows-repeated="2">
+		<table:table-cell/>
+	</table:table-row>
+	<table:table-row>
+		<table:table-cell table:number-columns-repeated="2"><text:p>x</text:p></table:table-cell>
+		<table:covered-table-cell/>
+		<table:table-cell><text:p>y</text:p></table:table-cell>
+	</table:table-row>
+	<table:table-row table:number-rows-repeated="1048000">
+		<table:table-cell table:number-columns-repeated="1024"/>
+	</table:table-row>
+</table:table>
+<table:table table:name="Empty"/>`
+
+func TestReadODSContent(t *testing.T) {
+	sheets, err := readODSContent(strings.NewReader(odsContent(odsTestTables)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sheets) != 2 || sheets[0].name != "Products" || sheets[1].name != "Empty" {
+		t.Fatalf("unexpected sheets %v", sheets)
+	}
+	expected := [][]string{
+		{"name", "price"},
+		{"apple  pie", "1,50"},
+		{"line 1\nline 2", "2"},
+		nil,
+		nil,
+		{"x", "x", "", "y"},
+	}
+	if !reflect.DeepEqual(sheets[0].rows, expected) {
+		t.Errorf("expected rows %q, got %q", expected, sheets[0].rows)
+	}
+	if len(sheets[1].rows) != 0 {
+		t.Errorf("expected no rows in the empty sheet, got %q", sheets[1].rows)
+	}
+}
+
+func TestNewODSReader(t *testing.T) {
+	file := odsFile(t, odsContent(odsTestTables))
+	reader, err := NewODSReader(file, file.Size(), SpreadsheetOptions{Sheet: "Products", HeaderRow: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"name", "price"}; !reflect.DeepEqual(reader.HeadContent, expected) {
+		t.Errorf("expected head %q, got %q", expected, reader.HeadContent)
+	}
+	// empty rows are skipped
+	if len(reader.ColumnsContent) != 3 || reader.ColumnsContent[2][3] != "y" {
+		t.Errorf("unexpected columns %q", reader.ColumnsContent)
+	}
+	for _, opts := range []SpreadsheetOptions{{Sheet: "Foo"}, {Sheet: "3"}, {Sheet: "2", HeaderRow: 1}, {HeaderRow: -1}} {
+		if _, err := NewODSReader(file, file.Size(), opts); err == nil {
+			t.Errorf("expected an error for options %+v", opts)
+		}
+	}
+	if _, err := NewODSReader(strings.NewReader("no zip"), 6, SpreadsheetOptions{}); err == nil {
+		t.Error("expected an error for an invalid file")
+	}
+}
+
+func TestNewXLSXReader(t *testing.T) {
+	f := excelize.NewFile()
+	defer f.Close()
+	rows := [][]interface{}{{"name", "price"}, {"apple", 1.5}, {}, {"pear", 2}}
+	for i, row := range rows {
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := f.SetSheetRow("Sheet1", cell, &row); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reader, err := NewXLSXReader(&buf, SpreadsheetOptions{Sheet: "1", HeaderRow: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := [][]string{{"apple", "1.5"}, {"pear", "2"}}
+	if !reflect.DeepEqual(reader.ColumnsContent, expected) {
+		t.Errorf("expected columns %q, got %q", expected, reader.ColumnsContent)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SQLiteDriver is the name of the database/sql driver used by
+// NewSQLiteFileReader. The driver must be registered by importing it, for
+// example with import _ "modernc.org/sqlite" (a driver without cgo).
+var SQLiteDriver = "sqlite"
+
+// SQLReader implements CollectionSource with the result of an SQL query: The
+// head are the names of the result columns and each row is a column of the
+// collection.
+type SQLReader struct {
+	HeadContent    []string
+	ColumnsContent [][]string
+}
+
+// NewSQLReader runs the query with the given arguments and returns a reader
+// with the result. NULL is converted to an empty string, numbers are written
+// without exponent and times in the form 2006-01-02 15:04:05 (or 2006-01-02 if
+// there is no time).
+//
+// This function exhaustively reads all rows in memory.
+func NewSQLReader(db *sql.DB, query string, args ...interface{}) (*SQLReader, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	head, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var columns [][]string
+	values := make([]interface{}, len(head))
+	pointers := make([]interface{}, len(head))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		col := make([]string, len(head))
+		for i, value := range values {
+			col[i] = sqlValueString(value)
+		}
+		columns = append(columns, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &SQLReader{
+			HeadContent:    head,
+			ColumnsContent: columns,
+		},
+		nil
+}
+
+// sqlValueString converts a value returned by a driver to a string.
+func sqlValueString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format("2006-01-02 15:04:05")
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// NewSQLiteFileReader runs the query on the SQLite database file (opened read
+// only) with SQLiteDriver, see NewSQLReader.
+func NewSQLiteFileReader(file, query string, args ...interface{}) (*SQLReader, error) {
+	registered := false
+	for _, driver := range sql.Drivers() {
+		if driver == SQLiteDriver {
+			registered = true
+			break
+		}
+	}
+	if !registered {
+		return nil, fmt.Errorf("sqlite driver \"%s\" is not available", SQLiteDriver)
+	}
+	// SQLite creates a new database if the file doesn't exist
+	if _, err := os.Stat(file); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(SQLiteDriver, "file:"+(&url.URL{Path: file}).EscapedPath()+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	var reader *SQLReader
+	defer func() {
+		closeErr := db.Close()
+		if err == nil && closeErr != nil {
+			reader = nil
+			err = closeErr
+		}
+	}()
+	reader, err = NewSQLReader(db, query, args...)
+	return reader, err
+}
+
+// Head returns the head.
+func (r *SQLReader) Head() ([]string, error) {
+	return r.HeadContent, nil
+}
+
+// Entries returns all columns.
+func (r *SQLReader) Entries() ([][]string, error) {
+	return r.ColumnsContent, nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteTestFile returns a database file with a table items.
+func sqliteTestFile(t *testing.T) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "shop db.sqlite")
+	db, err := sql.Open(SQLiteDriver, file)
+	if err != nil {
+		t.Fatalf("can't create database: %v", err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		`CREATE TABLE items (name TEXT, price REAL, qty INTEGER, note BLOB)`,
+		`INSERT INTO items VALUES ('apple', 1.5, 3, NULL), ('bread', 3, 1, X'6F6B')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("can't create database: %v", err)
+		}
+	}
+	return file
+}
+
+func TestNewSQLiteFileReader(t *testing.T) {
+	file := sqliteTestFile(t)
+	reader, err := NewSQLiteFileReader(file, "SELECT name, price, qty, note FROM items WHERE qty >= ? ORDER BY name", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"name", "price", "qty", "note"}; !reflect.DeepEqual(reader.HeadContent, expected) {
+		t.Errorf("expected head %q, got %q", expected, reader.HeadContent)
+	}
+	expected := [][]string{{"apple", "1.5", "3", ""}, {"bread", "3", "1", "ok"}}
+	if !reflect.DeepEqual(reader.ColumnsContent, expected) {
+		t.Errorf("expected columns %q, got %q", expected, reader.ColumnsContent)
+	}
+	// the database is opened read only
+	if _, err := NewSQLiteFileReader(file, "DELETE FROM items RETURNING name"); err == nil {
+		t.Error("expected an error for a write query")
+	}
+	if _, err := NewSQLiteFileReader(file, "SELECT foo FROM items"); err == nil {
+		t.Error("expected an error for an invalid query")
+	}
+	if _, err := NewSQLiteFileReader(filepath.Join(t.TempDir(), "missing.sqlite"), "SELECT 1"); err == nil {
+		t.Error("expected an error for a missing database")
+	}
+}
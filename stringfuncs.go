@@ -0,0 +1,200 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// Text is the result of the string functions ("upper", "truncate" etc.). It
+// contains the plain (not escaped) string and is escaped with the configured
+// LatexEscapeFunc when it is written. All functions of this package use the
+// plain string, so nesting string functions (or using "latex") doesn't escape
+// the value twice. Use .Plain to compare the result, for example
+// #(if eq (lower .Name).Plain "foo"#). Ellipsis (for example from "truncate")
+// is written as \dots{}.
+type Text struct {
+	Plain   string
+	replace LatexEscapeFunc
+}
+
+// newText returns a new Text. The string is escaped once to check that this is
+// possible: A panic of replace (for example a UnicodeError) must happen in the
+// template function, fmt would write the panic to the output instead of
+// reporting it when it happens in String.
+func newText(s string, replace LatexEscapeFunc) Text {
+	escapeText(s, replace)
+	return Text{s, replace}
+}
+
+// String returns the escaped string.
+func (t Text) String() string {
+	return escapeText(t.Plain, t.replace)
+}
+
+// escapeText escapes the plain string of a Text with replace (if not nil),
+// Ellipsis is replaced by \dots{}.
+func escapeText(s string, replace LatexEscapeFunc) string {
+	parts := strings.Split(s, Ellipsis)
+	if replace != nil {
+		for i, part := range parts {
+			parts[i] = replace(part)
+		}
+	}
+	return strings.Join(parts, `\dots{}`)
+}
+
+// plainString converts a template argument to a string, for Text the plain
+// string is used.
+func plainString(arg interface{}) string {
+	switch v := arg.(type) {
+	case Text:
+		return v.Plain
+	case string:
+		return v
+	default:
+		return fmt.Sprintf("%v", arg)
+	}
+}
+
+// isEmptyValue returns true if arg is nil, an empty string (or only contains
+// whitespace) or NoColEntry.
+func isEmptyValue(arg interface{}) bool {
+	if arg == nil {
+		return true
+	}
+	s := strings.TrimSpace(plainString(arg))
+	return s == "" || s == NoColEntry
+}
+
+// Ellipsis is appended to truncated strings, it is written as \dots{}.
+const Ellipsis = "…"
+
+// StringFuncs returns the string functions for templates, the results are
+// escaped with replace when written. The functions are:
+//
+//	upper s, lower s, title s, trim s
+//	replace old new s       replaces all occurrences of old by new
+//	regexReplace re repl s  replaces all matches of the regular expression re
+//	truncate n s            truncates s to n characters (including the ellipsis)
+//	padLeft n [pad] s       pads s on the left to n characters (default pad is a space)
+//	padRight n [pad] s      pads s on the right
+//	split sep s             splits s into a list of strings
+//	contains substr s, hasPrefix prefix s, hasSuffix suffix s
+//	default def s           def if s is empty (or NoColEntry), otherwise s
+//	coalesce args...        the first non-empty argument
+//
+// The string is always the last argument, so the functions can be used in
+// pipelines: #(.Name | trim | upper#).
+func StringFuncs(replace LatexEscapeFunc) template.FuncMap {
+	text := func(s string) Text {
+		return newText(s, replace)
+	}
+	pad := func(left bool) func(n int, args ...interface{}) (Text, error) {
+		return func(n int, args ...interface{}) (Text, error) {
+			padding := " "
+			switch len(args) {
+			case 1:
+			case 2:
+				padding = plainString(args[0])
+			default:
+				return Text{}, fmt.Errorf("pad expects 2 or 3 arguments, got %d", len(args)+1)
+			}
+			if utf8.RuneCountInString(padding) != 1 {
+				return Text{}, fmt.Errorf("padding must be a single character, got \"%s\"", padding)
+			}
+			s := plainString(args[len(args)-1])
+			if count := utf8.RuneCountInString(s); count < n {
+				if left {
+					s = strings.Repeat(padding, n-count) + s
+				} else {
+					s += strings.Repeat(padding, n-count)
+				}
+			}
+			return text(s), nil
+		}
+	}
+	return template.FuncMap{
+		"upper": func(s interface{}) Text {
+			return text(strings.ToUpper(plainString(s)))
+		},
+		"lower": func(s interface{}) Text {
+			return text(strings.ToLower(plainString(s)))
+		},
+		"title": func(s interface{}) Text {
+			// a Caser is stateful, so it can't be shared between calls
+			return text(cases.Title(language.Und).String(plainString(s)))
+		},
+		"trim": func(s interface{}) Text {
+			return text(strings.TrimSpace(plainString(s)))
+		},
+		"replace": func(old, new string, s interface{}) Text {
+			return text(strings.ReplaceAll(plainString(s), old, new))
+		},
+		"regexReplace": func(expr, repl string, s interface{}) (Text, error) {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return Text{}, err
+			}
+			return text(re.ReplaceAllString(plainString(s), repl)), nil
+		},
+		"truncate": func(n int, s interface{}) Text {
+			str := plainString(s)
+			if utf8.RuneCountInString(str) <= n {
+				return text(str)
+			}
+			if n < 1 {
+				return text("")
+			}
+			runes := []rune(str)
+			return text(strings.TrimRight(string(runes[:n-1]), " ") + Ellipsis)
+		},
+		"padLeft":  pad(true),
+		"padRight": pad(false),
+		"split": func(sep string, s interface{}) []string {
+			return strings.Split(plainString(s), sep)
+		},
+		"contains": func(substr string, s interface{}) bool {
+			return strings.Contains(plainString(s), substr)
+		},
+		"hasPrefix": func(prefix string, s interface{}) bool {
+			return strings.HasPrefix(plainString(s), prefix)
+		},
+		"hasSuffix": func(suffix string, s interface{}) bool {
+			return strings.HasSuffix(plainString(s), suffix)
+		},
+		"default": func(def, s interface{}) Text {
+			if isEmptyValue(s) {
+				return text(plainString(def))
+			}
+			return text(plainString(s))
+		},
+		"coalesce": func(args ...interface{}) Text {
+			for _, arg := range args {
+				if !isEmptyValue(arg) {
+					return text(plainString(arg))
+				}
+			}
+			return text("")
+		},
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+)
+
+func TestStringFuncs(t *testing.T) {
+	pdflatex := &EscapeProfile{Transliterate: true, Fallback: FallbackError}
+	data := map[string]string{"Name": " foo_bar baz ", "Long": "a_b c d"}
+	tests := []struct {
+		name     string
+		opts     *TemplateOptions
+		template string
+		expected string
+	}{
+		{"pipeline", &TemplateOptions{Replace: EscapeWithDefaults(nil)}, `#(.Name | trim | upper#)`, `FOO\_BAR BAZ`},
+		{"plain", &TemplateOptions{Replace: EscapeWithDefaults(nil)}, `#(if eq (lower "ABC").Plain "abc"#)yes#(end#)`, "yes"},
+		{"truncate", &TemplateOptions{Replace: EscapeWithDefaults(nil)}, `#(truncate 5 .Long#)`, `a\_b\dots{}`},
+		{"truncate short", &TemplateOptions{Replace: EscapeWithDefaults(nil)}, `#(truncate 7 .Long#)`, `a\_b c d`},
+		{"truncate upper", &TemplateOptions{Replace: EscapeWithDefaults(nil)}, `#(truncate 5 .Long | upper#)`, `A\_B\dots{}`},
+		{"truncate auto escape", autoEscapeOptions(), `#(truncate 5 .Long#) $#(truncate 5 .Long#)$`, `a\_b\dots{} $a\_b\dots{}$`},
+		{"truncate pdflatex", &TemplateOptions{Replace: pdflatex.EscapeFunc(), AutoEscape: true}, `#(truncate 5 .Long#)`, `a\_b\dots{}`},
+		{"truncate no escaping", &TemplateOptions{}, `#(truncate 5 .Long#)`, `a_b\dots{}`},
+		{"pad", &TemplateOptions{}, `#(padLeft 4 "0" "7"#)#(padRight 3 "x"#)|`, "0007x  |"},
+		{"default", &TemplateOptions{}, `#(default "none" ""#) #(coalesce "" "a" "b"#)`, "none a"},
+		{"title", &TemplateOptions{}, `#(title "hello wORLD"#) #(title "o'neil"#)`, "Hello World O'neil"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := executeTemplate(test.opts, data, test.template)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestTitleConcurrent(t *testing.T) {
+	tmpl, err := LatexTemplateWithOptions(template.New("t"), &TemplateOptions{}).Parse(`{{title .}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				var b strings.Builder
+				if err := tmpl.Execute(&b, "straße und weg"); err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+				if got, expected := b.String(), "Straße Und Weg"; got != expected {
+					t.Errorf("expected %q, got %q", expected, got)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,320 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TableStyle is the environment used by RenderTable.
+type TableStyle int
+
+const (
+	// TableTabular uses the tabular environment.
+	TableTabular TableStyle = iota
+	// TableLongtable uses the longtable environment (longtable package), the
+	// header is repeated on each page.
+	TableLongtable
+	// TableTabularx uses the tabularx environment (tabularx package).
+	TableTabularx
+)
+
+func (style TableStyle) String() string {
+	switch style {
+	case TableTabular:
+		return "tabular"
+	case TableLongtable:
+		return "longtable"
+	case TableTabularx:
+		return "tabularx"
+	default:
+		return fmt.Sprintf("TableStyle(%d)", int(style))
+	}
+}
+
+// ParseTableStyle parses a table style from its name, the names are
+// "tabular", "longtable" and "tabularx".
+func ParseTableStyle(s string) (TableStyle, error) {
+	switch s {
+	case "tabular":
+		return TableTabular, nil
+	case "longtable":
+		return TableLongtable, nil
+	case "tabularx":
+		return TableTabularx, nil
+	default:
+		return TableTabular, fmt.Errorf("invalid table style \"%s\": Must be tabular, longtable or tabularx", s)
+	}
+}
+
+// TableOptions describes how a collection is rendered by RenderTable.
+type TableOptions struct {
+	// Style is the table environment.
+	Style TableStyle
+	// Booktabs uses \toprule, \midrule and \bottomrule (booktabs package)
+	// instead of \hline.
+	Booktabs bool
+	// Columns are the row names (in this order) that are shown in the table, if
+	// it is empty all row names from the head are used.
+	Columns []string
+	// Align is the column specification, for example "lrr" or "l|r". If it is
+	// empty each column is left aligned (X for tabularx). If it is "auto"
+	// columns that contain only numbers are right aligned.
+	Align string
+	// Locale is used to detect numbers for the alignment "auto", if it is nil
+	// EnglishLocale is used.
+	Locale *Locale
+	// Width is the width of a tabularx table, the default is \linewidth.
+	Width string
+	// NoHeader disables the header line with the row names.
+	NoHeader bool
+	// Newlines describes how line breaks in cells are handled. NewlineSpace and
+	// NewlineReject work as usual, for all other policies line breaks become
+	// \newline in paragraph columns (p, m, b and X) and a nested tabular in all
+	// other columns, this way a cell never ends the table row.
+	Newlines NewlinePolicy
+}
+
+// ParseTableOptions parses options in the form "key=value", valid keys are
+// "style" (see ParseTableStyle), "columns" (a comma separated list), "align"
+// and "width". The options "booktabs" and "noheader" have no value.
+// Example: ["style=longtable", "booktabs", "columns=name,price", "align=lr"].
+func ParseTableOptions(args []string) (*TableOptions, error) {
+	opts := &TableOptions{}
+	for _, arg := range args {
+		key, value := arg, ""
+		if i := strings.IndexByte(arg, '='); i >= 0 {
+			key, value = arg[:i], arg[i+1:]
+		}
+		switch key {
+		case "style":
+			style, err := ParseTableStyle(value)
+			if err != nil {
+				return nil, err
+			}
+			opts.Style = style
+		case "booktabs":
+			opts.Booktabs = true
+		case "noheader":
+			opts.NoHeader = true
+		case "columns":
+			opts.Columns = strings.Split(value, ",")
+			for i, col := range opts.Columns {
+				opts.Columns[i] = strings.TrimSpace(col)
+			}
+		case "align":
+			opts.Align = value
+		case "width":
+			opts.Width = value
+		default:
+			return nil, fmt.Errorf("invalid table option \"%s\"", arg)
+		}
+	}
+	return opts, nil
+}
+
+// alignment returns the column specification for the given row names.
+func (opts *TableOptions) alignment(c *Collection, columns []string) string {
+	switch opts.Align {
+	case "":
+		if opts.Style == TableTabularx {
+			return strings.Repeat("X", len(columns))
+		}
+		return strings.Repeat("l", len(columns))
+	case "auto":
+		var b strings.Builder
+		for _, key := range columns {
+			_, err := c.Decimals(key, opts.Locale)
+			switch {
+			case err == nil:
+				b.WriteByte('r')
+			case opts.Style == TableTabularx:
+				b.WriteByte('X')
+			default:
+				b.WriteByte('l')
+			}
+		}
+		return b.String()
+	default:
+		return opts.Align
+	}
+}
+
+// columnTypes returns the type of each column in the column specification
+// align: 'l', 'c' or 'r' or 'p' for paragraph columns. Rules and arguments
+// like @{...} are skipped.
+func columnTypes(align string) []byte {
+	var res []byte
+	for i := 0; i < len(align); i++ {
+		switch align[i] {
+		case 'l', 'c', 'r':
+			res = append(res, align[i])
+		case 'p', 'm', 'b', 'X':
+			res = append(res, 'p')
+		case '{':
+			// skip arguments such as the width of p{3cm} or @{}
+			depth := 1
+			for i++; i < len(align) && depth > 0; i++ {
+				switch align[i] {
+				case '{':
+					depth++
+				case '}':
+					depth--
+				}
+			}
+			i--
+		}
+	}
+	return res
+}
+
+// cellLines converts the line breaks in an (escaped) cell of a column with
+// the given type (see columnTypes), see TableOptions.Newlines.
+func (opts *TableOptions) cellLines(cell string, columnType byte) (string, error) {
+	if !strings.ContainsAny(cell, "\r\n") {
+		return cell, nil
+	}
+	switch opts.Newlines {
+	case NewlineSpace, NewlineReject:
+		return opts.Newlines.Apply(cell)
+	}
+	lines := lineBreaks.Split(strings.Trim(cell, "\r\n"), -1)
+	switch columnType {
+	case 'p':
+		return strings.Join(lines, `\newline `), nil
+	case 'c', 'r':
+	default:
+		columnType = 'l'
+	}
+	return `\begin{tabular}[t]{@{}` + string(columnType) + `@{}}` + strings.Join(lines, `\\`) + `\end{tabular}`, nil
+}
+
+// rules returns the commands for the top, middle and bottom rule.
+func (opts *TableOptions) rules() (string, string, string) {
+	if opts.Booktabs {
+		return `\toprule`, `\midrule`, `\bottomrule`
+	}
+	return `\hline`, `\hline`, `\hline`
+}
+
+// RenderTable renders the collection as a complete table environment, each
+// column of the collection is a line in the table. escape is applied to all
+// cells and header entries, it can be nil. Line breaks in cells are handled
+// as described by opts.Newlines.
+func RenderTable(c *Collection, opts *TableOptions, escape func(s string) (string, error)) (string, error) {
+	if escape == nil {
+		escape = func(s string) (string, error) { return s, nil }
+	}
+	columns := opts.Columns
+	if len(columns) == 0 {
+		columns = c.Head
+	}
+	for _, key := range columns {
+		if !c.hasKey(key) {
+			return "", NewColKeyError("invalid key: %s, allowed keys are %s", key, strings.Join(c.Head, ", "))
+		}
+	}
+	align := opts.alignment(c, columns)
+	types := columnTypes(align)
+	line := func(cells []string) (string, error) {
+		escaped := make([]string, len(cells))
+		for i, cell := range cells {
+			var err error
+			if escaped[i], err = escape(cell); err != nil {
+				return "", err
+			}
+			var columnType byte
+			if i < len(types) {
+				columnType = types[i]
+			}
+			if escaped[i], err = opts.cellLines(escaped[i], columnType); err != nil {
+				return "", err
+			}
+		}
+		return strings.Join(escaped, " & ") + ` \\`, nil
+	}
+	top, mid, bottom := opts.rules()
+	var b strings.Builder
+	switch opts.Style {
+	case TableTabularx:
+		width := opts.Width
+		if width == "" {
+			width = `\linewidth`
+		}
+		b.WriteString(`\begin{tabularx}{` + width + `}{` + align + "}\n")
+	default:
+		b.WriteString(`\begin{` + opts.Style.String() + `}{` + align + "}\n")
+	}
+	b.WriteString(top + "\n")
+	if !opts.NoHeader {
+		header, err := line(columns)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(header + "\n" + mid + "\n")
+		if opts.Style == TableLongtable {
+			// repeat the header on each page
+			b.WriteString(`\endfirsthead` + "\n")
+			b.WriteString(top + "\n" + header + "\n" + mid + "\n")
+			b.WriteString(`\endhead` + "\n")
+			b.WriteString(bottom + "\n")
+			b.WriteString(`\endfoot` + "\n")
+			b.WriteString(`\endlastfoot` + "\n")
+		}
+	}
+	for _, col := range c.Columns {
+		cells := make([]string, len(columns))
+		for i, key := range columns {
+			if cells[i] = col.GetKey(key); cells[i] == NoColEntry {
+				cells[i] = ""
+			}
+		}
+		l, err := line(cells)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(l + "\n")
+	}
+	b.WriteString(bottom + "\n")
+	b.WriteString(`\end{` + opts.Style.String() + `}`)
+	return b.String(), nil
+}
+
+// Table returns the template function "table". The arguments are options (see
+// ParseTableOptions) followed by the collection. Cells are escaped with
+// replace (if not nil), line breaks are handled as described by
+// TableOptions.Newlines with the given policy and numbers are detected with
+// the given locale.
+// Example: #(table "style=longtable" "booktabs" "columns=name,price" .data#).
+func Table(replace LatexEscapeFunc, policy NewlinePolicy, loc *Locale) func(args ...interface{}) (string, error) {
+	escaper := LatexEscaper(replace)
+	escape := func(s string) (string, error) {
+		return escaper(s), nil
+	}
+	return func(args ...interface{}) (string, error) {
+		strs, c, err := collectionArgs("table", args)
+		if err != nil {
+			return "", err
+		}
+		opts, err := ParseTableOptions(strs)
+		if err != nil {
+			return "", err
+		}
+		opts.Newlines = policy
+		opts.Locale = loc
+		return RenderTable(c, opts, escape)
+	}
+}
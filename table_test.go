@@ -0,0 +1,119 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestColumnTypes(t *testing.T) {
+	tests := []struct {
+		align, expected string
+	}{
+		{"lrc", "lrc"},
+		{"|l|r|", "lr"},
+		{"lp{3cm}X", "lpp"},
+		{`@{}l>{\raggedright}p{2cm}@{}`, "lp"},
+		{"m{1cm}b{2cm}", "pp"},
+	}
+	for _, test := range tests {
+		if got := string(columnTypes(test.align)); got != test.expected {
+			t.Errorf("columnTypes(%q): expected %q, got %q", test.align, test.expected, got)
+		}
+	}
+}
+
+func TestTableNewlines(t *testing.T) {
+	c := testCollection(t, []string{"name", "note"}, []string{"a&b", "line 1\nline 2"})
+	tests := []struct {
+		policy   NewlinePolicy
+		args     []string
+		expected string
+	}{
+		{NewlineBreak, []string{"noheader"},
+			"\\begin{tabular}{ll}\n\\hline\n" +
+				`a\&b & \begin{tabular}[t]{@{}l@{}}line 1\\line 2\end{tabular} \\` +
+				"\n\\hline\n\\end{tabular}"},
+		{NewlineKeep, []string{"noheader", "align=rr"},
+			"\\begin{tabular}{rr}\n\\hline\n" +
+				`a\&b & \begin{tabular}[t]{@{}r@{}}line 1\\line 2\end{tabular} \\` +
+				"\n\\hline\n\\end{tabular}"},
+		{NewlineBreak, []string{"noheader", "align=lp{3cm}"},
+			"\\begin{tabular}{lp{3cm}}\n\\hline\n" +
+				`a\&b & line 1\newline line 2 \\` +
+				"\n\\hline\n\\end{tabular}"},
+		{NewlineSpace, []string{"noheader", "style=tabularx"},
+			"\\begin{tabularx}{\\linewidth}{XX}\n\\hline\n" +
+				`a\&b & line 1 line 2 \\` +
+				"\n\\hline\n\\end{tabularx}"},
+	}
+	for _, test := range tests {
+		args := make([]interface{}, 0, len(test.args)+1)
+		for _, arg := range test.args {
+			args = append(args, arg)
+		}
+		args = append(args, c)
+		got, err := Table(EscapeWithDefaults(nil), test.policy, nil)(args...)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != test.expected {
+			t.Errorf("policy %s, options %v: expected %q, got %q", test.policy, test.args, test.expected, got)
+		}
+	}
+	if got, err := Table(nil, NewlineReject, nil)(c); err == nil {
+		t.Errorf("expected an error for a line break with policy reject, got %q", got)
+	}
+}
+
+func TestTableAutoAlign(t *testing.T) {
+	tests := []struct {
+		loc      *Locale
+		prices   []string
+		expected string
+	}{
+		{nil, []string{"1,234.50", "2.10"}, "lr"},
+		{GermanLocale, []string{"1.234,50", "2,10"}, "lr"},
+		{FrenchLocale, []string{"1 234,50", "2,10"}, "lr"},
+		{nil, []string{"1.234,50", "2,10"}, "ll"},
+		{GermanLocale, []string{"1,234.50", "2.10"}, "ll"},
+	}
+	for _, test := range tests {
+		c := testCollection(t, []string{"name", "price"}, []string{"a", test.prices[0]}, []string{"b", test.prices[1]})
+		got, err := Table(nil, NewlineKeep, test.loc)("noheader", "align=auto", c)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if expected := `\begin{tabular}{` + test.expected + "}"; !strings.HasPrefix(got, expected) {
+			t.Errorf("%v: expected alignment %q, got %q", test.prices, test.expected, got)
+		}
+	}
+}
+
+func TestParseTableOptions(t *testing.T) {
+	opts, err := ParseTableOptions([]string{"style=longtable", "booktabs", "columns=name, price", "align=lr"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &TableOptions{Style: TableLongtable, Booktabs: true, Columns: []string{"name", "price"}, Align: "lr"}
+	if !reflect.DeepEqual(opts, expected) {
+		t.Errorf("expected %+v, got %+v", expected, opts)
+	}
+	if _, err := ParseTableOptions([]string{"style=foo"}); err == nil {
+		t.Error("expected an error for an invalid style")
+	}
+}
@@ -19,11 +19,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"text/template"
 	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
 )
 
 // LatexEscapeFunc is any function that replaces LaTeX special character within
@@ -46,19 +51,26 @@ func LatexEscapeFromList(mapping []string) LatexEscapeFunc {
 // Verb returns a LaTeX verb environment with the given delimiter. For example
 // Verb("|", "foo & bar") yields to \verb|foo & bar|. An error is returned if
 // the delimiter is contained in the input string or if delimiter has a length
-// != 1.
+// != 1. If the delimiter is the empty string it is chosen by ChooseDelimiter.
 func Verb(del string, args ...interface{}) (string, error) {
-	count := utf8.RuneCountInString(del)
-	if count != 1 {
-		return "", fmt.Errorf(`invalid delimiter length for \verb environment: Expected 1 and got %d`, count)
-	}
 	// not the way the template packages uses, that does more interesting stuff
 	// but I think it should be enough this way
 	asStrings := make([]string, len(args))
 	for i, arg := range args {
-		asStrings[i] = fmt.Sprintf("%v", arg)
+		asStrings[i] = plainString(arg)
 	}
 	s := strings.Join(asStrings, " ")
+	if del == "" {
+		var err error
+		del, err = ChooseDelimiter(s)
+		if err != nil {
+			return "", err
+		}
+	}
+	count := utf8.RuneCountInString(del)
+	if count != 1 {
+		return "", fmt.Errorf(`invalid delimiter length for \verb environment: Expected 1 and got %d`, count)
+	}
 	if strings.Contains(s, del) {
 		return "", fmt.Errorf(`error executing \verb environment: Input string contains delimiter %s`, del)
 	}
@@ -82,7 +94,7 @@ func Join(replace LatexEscapeFunc) func(sep string, args ...interface{}) string
 					asStrings = append(asStrings, a)
 				}
 			} else {
-				var a = fmt.Sprintf("%v", arg)
+				var a = plainString(arg)
 				if replace != nil {
 					a = replace(a)
 				}
@@ -115,64 +127,259 @@ var (
 // Example: ["&", "\\&"] would replace each occurrence of & with \&.
 // This replacement is already done by the DefaultReplacers though.
 func EscapeWithDefaults(additional []string) LatexEscapeFunc {
-	fullReplacers := make([]string, len(DefaultReplacers)+len(additional))
-	copy(fullReplacers, DefaultReplacers)
-	copy(fullReplacers[len(DefaultReplacers):], additional)
-	return LatexEscapeFromList(fullReplacers)
+	return LatexEscapeFromList(concatReplacers(DefaultReplacers, additional))
+}
+
+// EscapeWithOverrides works as EscapeWithDefaults, but the replacers from
+// additional take precedence, so they can be used to override the defaults.
+// Example: ["~", "\\string~"] replaces ~ with \string~ instead of
+// \textasciitilde.
+func EscapeWithOverrides(additional []string) LatexEscapeFunc {
+	return LatexEscapeFromList(concatReplacers(additional, DefaultReplacers))
+}
+
+// concatReplacers returns a new list with the pairs from first followed by the
+// pairs from second.
+func concatReplacers(first, second []string) []string {
+	res := make([]string, len(first)+len(second))
+	copy(res, first)
+	copy(res[len(first):], second)
+	return res
+}
+
+var (
+	// MathReplacers describes the replacer pairs for math mode. Text mode
+	// commands like \textasciitilde are not allowed in math mode, so they're
+	// replaced by their math mode counterparts.
+	MathReplacers = []string{
+		"&", `\&`,
+		"%", `\%`,
+		"$", `\$`,
+		"#", `\#`,
+		"_", `\_`,
+		"{", `\{`,
+		"}", `\}`,
+		"~", `\sim `,
+		"^", `\hat{}`,
+		`\`, `\backslash `,
+	}
+)
+
+// MathEscapeWithDefaults returns an escape function for math mode that uses
+// the content from MathReplacers and combines it with the replacers from
+// additional. It works as EscapeWithDefaults.
+func MathEscapeWithDefaults(additional []string) LatexEscapeFunc {
+	return LatexEscapeFromList(concatReplacers(MathReplacers, additional))
+}
+
+// MathEscapeWithOverrides works as MathEscapeWithDefaults, but the replacers
+// from additional take precedence, see EscapeWithOverrides.
+func MathEscapeWithOverrides(additional []string) LatexEscapeFunc {
+	return LatexEscapeFromList(concatReplacers(additional, MathReplacers))
+}
+
+// mathEscapeFor returns the escape function for math mode that belongs to the
+// text mode function replace. If replace is nil no escaping takes place in
+// math mode either and nil is returned.
+func mathEscapeFor(replace LatexEscapeFunc) LatexEscapeFunc {
+	if replace == nil {
+		return nil
+	}
+	return MathEscapeWithDefaults(nil)
 }
 
 // LatexEscaper returns a function that escapes an arbitrary number of
-// arguments with the specified escaping function.
+// arguments with the specified escaping function. If replace is nil the
+// arguments are not escaped.
 func LatexEscaper(replace LatexEscapeFunc) func(args ...interface{}) string {
 	return func(args ...interface{}) string {
 		// not the way the template packages uses, that does more interesting stuff
 		// but I think it should be enough this way
 		asStrings := make([]string, len(args))
 		for i, arg := range args {
-			asStrings[i] = fmt.Sprintf("%v", arg)
+			asStrings[i] = plainString(arg)
 		}
 		s := strings.Join(asStrings, " ")
+		if replace == nil {
+			return s
+		}
 		return replace(s)
 	}
 }
 
-// LatexTemplate adds the functions "latex", "verb", and "join" to the template.
+// Raw marks the concatenation of args as trusted LaTeX code, the result is
+// never escaped by the auto escaper.
+func Raw(args ...interface{}) RawLatex {
+	asStrings := make([]string, len(args))
+	for i, arg := range args {
+		asStrings[i] = plainString(arg)
+	}
+	return RawLatex(strings.Join(asStrings, " "))
+}
+
+// TemplateOptions configures the functions that are added to a template by
+// LatexTemplateWithOptions and how templates are parsed by
+// ParseTemplatesWithOptions.
+type TemplateOptions struct {
+	// Replace is used to escape LaTeX special characters, if it is nil no
+	// replacement takes place.
+	Replace LatexEscapeFunc
+	// MathReplace is used in math mode by "mathlatex" and the auto escaper, for
+	// example the result of EscapeProfile.MathEscapeFunc. If it is nil
+	// MathEscapeWithDefaults(nil) is used, unless Replace is nil as well.
+	MathReplace LatexEscapeFunc
+	// Quotes is the quote style used by "smarttext".
+	Quotes QuoteStyle
+	// Newlines describes how line breaks are handled by "latex" and in text
+	// context by the auto escaper.
+	Newlines NewlinePolicy
+	// AutoEscape enables context-aware escaping, see AutoEscapeTemplate.
+	AutoEscape bool
+	// Numbers configures the number functions "num", "fixed", "percent",
+	// "thousands" and "round", the money functions "money", "mul", "add" and
+	// "vat" and the aggregate functions "sum", "avg", "min" and "max".
+	Numbers NumberFormat
+	// Dates configures the date functions "date", "parseDate" and "now".
+	Dates DateFormat
+	// SearchPath contains directories with templates (for example partials or
+	// base templates with blocks) that are parsed before the given templates,
+	// see ParseTemplatesFS.
+	SearchPath []fs.FS
+	// Warn is called for each warning from CheckMacroDelimiters while parsing
+	// templates, if it is nil the check is skipped.
+	Warn func(w TemplateWarning)
+}
+
+// mathReplace returns the escape function for math mode, see MathReplace.
+func (opts *TemplateOptions) mathReplace() LatexEscapeFunc {
+	if opts.MathReplace != nil {
+		return opts.MathReplace
+	}
+	return mathEscapeFor(opts.Replace)
+}
+
+// LatexFuncs returns the functions that are added to a template by
+// LatexTemplateWithOptions.
+func LatexFuncs(opts *TemplateOptions) template.FuncMap {
+	replace := opts.Replace
+	funcs := template.FuncMap{
+		"latex":         LatexNewlineEscaper(replace, opts.Newlines),
+		"latexnl":       LatexLines(replace),
+		"mathlatex":     LatexEscaper(opts.mathReplace()),
+		"verb":          Verb,
+		"join":          Join(replace),
+		"raw":           Raw,
+		"url":           URL,
+		"href":          Href(replace),
+		"smarttext":     LatexEscaper(SmartTextEscaper(opts.Quotes, replace)),
+		"markdown":      Markdown(replace),
+		"lstinline":     Lstinline,
+		"mintinline":    Mintinline,
+		"codeblock":     CodeBlock,
+		"num":           opts.Numbers.Num,
+		"fixed":         opts.Numbers.Fixed,
+		"percent":       opts.Numbers.Percent,
+		"thousands":     opts.Numbers.Thousands,
+		"round":         opts.Numbers.Round,
+		"money":         opts.Numbers.Money,
+		"mul":           opts.Numbers.Mul,
+		"add":           opts.Numbers.Add,
+		"vat":           opts.Numbers.Vat,
+		"date":          opts.Dates.DateText(replace),
+		"parseDate":     opts.Dates.ParseDate,
+		"now":           opts.Dates.CurrentTime,
+		"sum":           opts.Numbers.Sum,
+		"avg":           opts.Numbers.Avg,
+		"min":           opts.Numbers.Min,
+		"max":           opts.Numbers.Max,
+		"count":         Count,
+		"countDistinct": CountDistinct,
+		"where":         opts.Numbers.Where,
+		"sortBy":        opts.Numbers.SortBy,
+		"groupBy":       GroupByFunc,
+		"distinct":      DistinctFunc,
+		"chunk":         ChunkFunc,
+		"lookup":        LookupFunc,
+		"innerJoin":     InnerJoinFunc,
+		"leftJoin":      LeftJoinFunc,
+		"table":         Table(replace, opts.Newlines, opts.Numbers.Locale),
+	}
+	for name, f := range StringFuncs(replace) {
+		funcs[name] = f
+	}
+	return funcs
+}
+
+// LatexTemplate adds the functions "latex", "latexnl", "mathlatex", "verb",
+// "join", "raw", "url", "href", "smarttext", "markdown", "lstinline",
+// "mintinline", "codeblock", "num", "fixed", "percent", "thousands", "round",
+// "money", "mul", "add", "vat", "date", "parseDate", "now", "sum", "avg",
+// "min", "max", "count", "countDistinct", "where", "sortBy", "groupBy",
+// "distinct", "chunk", "lookup", "innerJoin", "leftJoin", "table" and the
+// string functions from StringFuncs to the template.
+// "latexnl" is LatexLines. "mathlatex" escapes its arguments for math mode
+// with MathEscapeWithDefaults, unless replace is nil. "url" and "href" are URL
+// and Href. "smarttext" escapes its arguments and applies SmartText with
+// EnglishQuotes. "markdown" is Markdown. "lstinline", "mintinline" and
+// "codeblock" are Lstinline, Mintinline and CodeBlock. The number and money
+// functions are the methods of NumberFormat with the English locale, "date",
+// "parseDate" and "now" are DateText, ParseDate and CurrentTime of DateFormat.
+// The aggregate functions expect a row name and a Collection, see
+// NumberFormat.Sum. "where" and "sortBy" are NumberFormat.Where and
+// NumberFormat.SortBy, "groupBy", "distinct" and "chunk" are GroupByFunc,
+// DistinctFunc and ChunkFunc. "lookup", "innerJoin" and "leftJoin" are
+// LookupFunc, InnerJoinFunc and LeftJoinFunc. "table" is Table.
 // This function must be called before the template is parsed.
 func LatexTemplate(t *template.Template, replace LatexEscapeFunc) *template.Template {
-	funcMap := template.FuncMap{
-		"latex": LatexEscaper(replace),
-		"verb":  Verb,
-		"join":  Join(replace),
-	}
-	return t.Funcs(funcMap)
+	return LatexTemplateWithOptions(t, &TemplateOptions{Replace: replace})
+}
+
+// LatexTemplateWithOptions works as LatexTemplate but the functions are
+// configured by opts.
+func LatexTemplateWithOptions(t *template.Template, opts *TemplateOptions) *template.Template {
+	return t.Funcs(LatexFuncs(opts))
 }
 
 // ParseTemplates parses the templates specified by filenames. See Go
 // template documentation for ParseTemplates for details. The functions
-// "latex", "verb" and "join" are added. The replace function is used to escape
+// from LatexTemplate are added. The replace function is used to escape
 // special characters, if it is nil no replacement takes place.
 // Delims defines which delimiters are used. The default {{ and }} are not nice for latex, so we replace them.
 // #( and #) seem to be a good idea. This is what happens when you use the empty string as delims.
 func ParseTemplates(replace LatexEscapeFunc, delimLeft, delimRight string, filenames ...string) (*template.Template, error) {
-	if delimLeft == "" {
-		delimLeft = "#("
-	}
+	return ParseTemplatesWithOptions(&TemplateOptions{Replace: replace}, delimLeft, delimRight, filenames...)
+}
 
-	if delimRight == "" {
-		delimRight = "#)"
+// ParseTemplatesWithOptions works as ParseTemplates but the functions are
+// configured by opts. If opts.AutoEscape is true AutoEscapeTemplate is called
+// with NewAutoEscaper(opts.Replace) and the newline policy from opts.
+//
+// Raw blocks in the templates are replaced with PreprocessRawBlocks before
+// parsing. If opts.Warn is not nil each file is checked with
+// CheckMacroDelimiters.
+//
+// The templates from opts.SearchPath are parsed before the files, see
+// ParseTemplatesFS.
+func ParseTemplatesWithOptions(opts *TemplateOptions, delimLeft, delimRight string, filenames ...string) (*template.Template, error) {
+	if len(filenames) == 0 {
+		return nil, errors.New("no template file names given")
 	}
-
-	if len(filenames) > 0 {
-		// TODO naming should be fine? I think that's what the comment in ParseFiles
-		// in the source code means...
-		name := path.Base(filenames[0])
-		t, err := LatexTemplate(template.New(name), replace).Delims(delimLeft, delimRight).ParseFiles(filenames...)
+	// TODO naming should be fine? I think that's what the comment in ParseFiles
+	// in the source code means...
+	p, err := newTemplateParser(opts, path.Base(filenames[0]), delimLeft, delimRight)
+	if err != nil {
+		return nil, err
+	}
+	for _, filename := range filenames {
+		content, err := os.ReadFile(filename)
 		if err != nil {
 			return nil, err
 		}
-		return t, nil
+		if err := p.parse(path.Base(filename), string(content)); err != nil {
+			return nil, err
+		}
 	}
-	return nil, errors.New("no template file names given")
+	return p.finish()
 }
 
 // TemplateConstJSON parses a constant json file, it must be a dictionary
@@ -205,3 +412,50 @@ func TemplateConstFromJSONFile(file string) (map[string]string, error) {
 	m, err = TemplateConstJSON(f)
 	return m, err
 }
+
+// TemplateConstYAML works as TemplateConstJSON but parses YAML. Numbers,
+// booleans and dates are converted to strings.
+func TemplateConstYAML(r io.Reader) (map[string]string, error) {
+	m := make(map[string]string)
+	if err := yaml.NewDecoder(r).Decode(&m); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return m, nil
+}
+
+// TemplateConstTOML works as TemplateConstJSON but parses TOML. Numbers,
+// booleans and dates are converted to strings.
+func TemplateConstTOML(r io.Reader) (map[string]string, error) {
+	var m map[string]interface{}
+	if _, err := toml.NewDecoder(r).Decode(&m); err != nil {
+		return nil, err
+	}
+	return stringValues(m)
+}
+
+// TemplateConstFromFile reads a constant file. Files ending in ".yaml" or
+// ".yml" are parsed with TemplateConstYAML, files ending in ".toml" with
+// TemplateConstTOML and all other files with TemplateConstJSON.
+func TemplateConstFromFile(file string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]string
+	defer func() {
+		closeErr := f.Close()
+		if err == nil && closeErr != nil {
+			m = nil
+			err = closeErr
+		}
+	}()
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		m, err = TemplateConstYAML(f)
+	case ".toml":
+		m, err = TemplateConstTOML(f)
+	default:
+		m, err = TemplateConstJSON(f)
+	}
+	return m, err
+}
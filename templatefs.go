@@ -0,0 +1,205 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"text/template"
+	"text/template/parse"
+)
+
+// TemplateExtensions are the file extensions of the templates that are loaded
+// from a search path.
+var TemplateExtensions = []string{".tex", ".tmpl", ".sty", ".cls"}
+
+// templateParser parses several templates into a single template set.
+type templateParser struct {
+	t                     *template.Template
+	opts                  *TemplateOptions
+	delimLeft, delimRight string
+	// fromBlock contains the names of the templates that are defined by a
+	// block (and not overwritten by a define)
+	fromBlock map[string]bool
+}
+
+// newTemplateParser returns a parser for a template set with the given name.
+// Empty delimiters are replaced by #( and #). All templates from the search
+// path are parsed.
+func newTemplateParser(opts *TemplateOptions, name, delimLeft, delimRight string) (*templateParser, error) {
+	if delimLeft == "" {
+		delimLeft = "#("
+	}
+
+	if delimRight == "" {
+		delimRight = "#)"
+	}
+	t := LatexTemplateWithOptions(template.New(name), opts).Delims(delimLeft, delimRight)
+	p := &templateParser{t, opts, delimLeft, delimRight, make(map[string]bool)}
+	// parse in reverse order, this way the first directory takes precedence
+	for i := len(opts.SearchPath) - 1; i >= 0; i-- {
+		if err := p.parseSearchPath(opts.SearchPath[i]); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// definedNames returns the names of all templates defined in text with the
+// given action (block or define).
+func (p *templateParser) definedNames(action, text string) []string {
+	re := regexp.MustCompile(regexp.QuoteMeta(p.delimLeft) + `-?\s*` + action + `\s+"([^"]*)"`)
+	var res []string
+	for _, match := range re.FindAllStringSubmatch(text, -1) {
+		res = append(res, match[1])
+	}
+	return res
+}
+
+// parse parses the template text with the given name. A block never replaces
+// a template that is defined with define, this way the order of base and
+// child templates doesn't matter.
+func (p *templateParser) parse(name, text string) error {
+	if p.opts.Warn != nil {
+		for _, w := range CheckMacroDelimiters(name, text, p.delimLeft, p.delimRight) {
+			p.opts.Warn(w)
+		}
+	}
+	text, err := PreprocessRawBlocks(text, p.delimLeft, p.delimRight)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	blocks := p.definedNames("block", text)
+	defines := p.definedNames("define", text)
+	keep := make(map[string]*parse.Tree)
+	for _, block := range blocks {
+		if old := p.t.Lookup(block); old != nil && old.Tree != nil && !p.fromBlock[block] {
+			keep[block] = old.Tree
+		}
+	}
+	tmpl := p.t
+	if name != p.t.Name() {
+		tmpl = p.t.New(name)
+	}
+	if _, err := tmpl.Parse(text); err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		if tree, has := keep[block]; has {
+			if _, err := p.t.AddParseTree(block, tree); err != nil {
+				return err
+			}
+		} else {
+			p.fromBlock[block] = true
+		}
+	}
+	for _, define := range defines {
+		p.fromBlock[define] = false
+	}
+	return nil
+}
+
+// hasTemplateExtension returns true if the extension of name is in
+// TemplateExtensions.
+func hasTemplateExtension(name string) bool {
+	ext := path.Ext(name)
+	for _, templateExt := range TemplateExtensions {
+		if ext == templateExt {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSearchPath parses all templates from fsys (see TemplateExtensions),
+// the name of each template is its path in fsys.
+func (p *templateParser) parseSearchPath(fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !hasTemplateExtension(name) {
+			return nil
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		return p.parse(name, string(content))
+	})
+}
+
+// finish applies the auto escaper if enabled and returns the template.
+func (p *templateParser) finish() (*template.Template, error) {
+	if p.opts.AutoEscape {
+		esc := NewAutoEscaper(p.opts.Replace)
+		esc.Math = p.opts.mathReplace()
+		esc.Newlines = p.opts.Newlines
+		if err := AutoEscapeTemplate(p.t, esc); err != nil {
+			return nil, err
+		}
+	}
+	return p.t, nil
+}
+
+// ParseTemplatesFS works as ParseTemplatesWithOptions but reads the templates
+// from fsys (for example an embed.FS). The templates are given by patterns
+// (see fs.Glob), the name of each template is the base name of its path. The
+// result is named after the first match.
+//
+// Templates from opts.SearchPath are parsed first, their names are their path
+// in the file system (for example "partials/table.tex"), so they can be used
+// with #(template "partials/table.tex" .#). If a template exists in several
+// directories of the search path the first one is used, the templates given by
+// patterns overwrite templates from the search path.
+//
+// Template inheritance works with blocks: A base template defines sections
+// with #(block "content" .#)default#(end#) and a child template overrides
+// them with #(define "content"#)...#(end#) and executes the base with
+// #(template "base.tex" .#). A define always takes precedence over a block,
+// independent of the order of the templates.
+func ParseTemplatesFS(opts *TemplateOptions, delimLeft, delimRight string, fsys fs.FS, patterns ...string) (*template.Template, error) {
+	var names []string
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("pattern matches no files: %#q", pattern)
+		}
+		names = append(names, matches...)
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no template file names given")
+	}
+	p, err := newTemplateParser(opts, path.Base(names[0]), delimLeft, delimRight)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.parse(path.Base(name), string(content)); err != nil {
+			return nil, err
+		}
+	}
+	return p.finish()
+}
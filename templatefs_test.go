@@ -0,0 +1,116 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func mapFS(files map[string]string) fstest.MapFS {
+	fsys := make(fstest.MapFS, len(files))
+	for name, text := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(text)}
+	}
+	return fsys
+}
+
+func TestParseTemplatesFSSearchPath(t *testing.T) {
+	base := `A#(block "content" .#)default#(end#)B`
+	child := `#(define "content"#)child#(end#)#(template "base.tex" .#)`
+	tests := []struct {
+		name       string
+		files      map[string]string
+		searchPath []fs.FS
+		patterns   []string
+		execute    string
+		expected   string
+	}{
+		{
+			"partial",
+			map[string]string{"main.tex": `#(range .#)#(template "partials/row.tex" .#)#(end#)`},
+			[]fs.FS{mapFS(map[string]string{"partials/row.tex": `[#(.#)]`, "partials/notes.txt": `#(`})},
+			[]string{"main.tex"}, "main.tex", "[a][b]",
+		},
+		{
+			"child first",
+			map[string]string{"base.tex": base, "child.tex": child},
+			nil, []string{"child.tex", "base.tex"}, "child.tex", "AchildB",
+		},
+		{
+			"base first",
+			map[string]string{"base.tex": base, "child.tex": child},
+			nil, []string{"base.tex", "child.tex"}, "child.tex", "AchildB",
+		},
+		{
+			"base in search path",
+			map[string]string{"child.tex": child},
+			[]fs.FS{mapFS(map[string]string{"base.tex": base})},
+			[]string{"child.tex"}, "child.tex", "AchildB",
+		},
+		{
+			"block default",
+			map[string]string{"base.tex": base},
+			nil, []string{"base.tex"}, "base.tex", "AdefaultB",
+		},
+		{
+			"first directory wins",
+			map[string]string{"main.tex": `#(template "p.tex"#)`},
+			[]fs.FS{mapFS(map[string]string{"p.tex": "first"}), mapFS(map[string]string{"p.tex": "second"})},
+			[]string{"main.tex"}, "main.tex", "first",
+		},
+		{
+			"pattern overwrites search path",
+			map[string]string{"main.tex": `#(template "p.tex"#)`, "p.tex": "pattern"},
+			[]fs.FS{mapFS(map[string]string{"p.tex": "search path"})},
+			[]string{"*.tex"}, "main.tex", "pattern",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := &TemplateOptions{SearchPath: test.searchPath}
+			tmpl, err := ParseTemplatesFS(opts, "", "", mapFS(test.files), test.patterns...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var b strings.Builder
+			if err := tmpl.ExecuteTemplate(&b, test.execute, []string{"a", "b"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := b.String(); got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseTemplatesFSErrors(t *testing.T) {
+	fsys := mapFS(map[string]string{"raw.tex": "a\n#(raw#)b", "ok.tex": "x"})
+	_, err := ParseTemplatesFS(&TemplateOptions{}, "", "", fsys, "raw.tex")
+	if err == nil || !strings.HasPrefix(err.Error(), "raw.tex: line 2: ") {
+		t.Errorf("expected an error for raw.tex in line 2, got %v", err)
+	}
+	for _, patterns := range [][]string{nil, {"missing.tex"}, {"["}} {
+		if _, err := ParseTemplatesFS(&TemplateOptions{}, "", "", fsys, patterns...); err == nil {
+			t.Errorf("%v: expected an error", patterns)
+		}
+	}
+	opts := &TemplateOptions{SearchPath: []fs.FS{mapFS(map[string]string{"bad.tex": "#(end#)"})}}
+	if _, err := ParseTemplatesFS(opts, "", "", fsys, "ok.tex"); err == nil {
+		t.Error("search path: expected an error")
+	}
+}
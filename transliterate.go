@@ -0,0 +1,307 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// UnicodeFallback describes what a Transliterator does with a rune that can't
+// be expressed with LaTeX commands.
+type UnicodeFallback int
+
+const (
+	// FallbackError reports an error of type UnicodeError.
+	FallbackError UnicodeFallback = iota
+	// FallbackDrop removes the rune.
+	FallbackDrop
+	// FallbackQuestionMark replaces the rune by "?".
+	FallbackQuestionMark
+)
+
+func (fallback UnicodeFallback) String() string {
+	switch fallback {
+	case FallbackError:
+		return "error"
+	case FallbackDrop:
+		return "drop"
+	case FallbackQuestionMark:
+		return "?"
+	default:
+		return fmt.Sprintf("UnicodeFallback(%d)", int(fallback))
+	}
+}
+
+// ParseUnicodeFallback parses a fallback from its name, the names are "error",
+// "drop" and "?".
+func ParseUnicodeFallback(s string) (UnicodeFallback, error) {
+	switch s {
+	case "error":
+		return FallbackError, nil
+	case "drop":
+		return FallbackDrop, nil
+	case "?", "question":
+		return FallbackQuestionMark, nil
+	default:
+		return FallbackError, fmt.Errorf("invalid unicode fallback \"%s\", must be error, drop or ?", s)
+	}
+}
+
+// UnicodeError is returned if a rune can't be transliterated.
+type UnicodeError struct {
+	Rune rune
+}
+
+func (err UnicodeError) Error() string {
+	return fmt.Sprintf("can't transliterate %q (%U) to LaTeX", err.Rune, err.Rune)
+}
+
+var (
+	// UnicodeSymbols maps runes that are not a combination of an ASCII letter and
+	// accents to LaTeX commands. Some of them require the textcomp package
+	// (included in the LaTeX kernel since 2020).
+	UnicodeSymbols = map[rune]string{
+		// letters
+		'ß': `\ss{}`,
+		'æ': `\ae{}`,
+		'Æ': `\AE{}`,
+		'œ': `\oe{}`,
+		'Œ': `\OE{}`,
+		'ø': `\o{}`,
+		'Ø': `\O{}`,
+		'ł': `\l{}`,
+		'Ł': `\L{}`,
+		'đ': `\dj{}`,
+		'Đ': `\DJ{}`,
+		'ð': `\dh{}`,
+		'Ð': `\DH{}`,
+		'þ': `\th{}`,
+		'Þ': `\TH{}`,
+		'ŋ': `\ng{}`,
+		'Ŋ': `\NG{}`,
+		'ı': `\i{}`,
+		'ȷ': `\j{}`,
+		// punctuation
+		'\u00a0': `~`,
+		'\u2009': `\,`,
+		'\u00ad': `\-`,
+		'¡':      `\textexclamdown{}`,
+		'¿':      `\textquestiondown{}`,
+		'«':      `\guillemotleft{}`,
+		'»':      `\guillemotright{}`,
+		'‹':      `\guilsinglleft{}`,
+		'›':      `\guilsinglright{}`,
+		'“':      "``",
+		'”':      "''",
+		'‘':      "`",
+		'’':      "'",
+		'„':      `\quotedblbase{}`,
+		'‚':      `\quotesinglbase{}`,
+		'–':      `--`,
+		'—':      `---`,
+		'…':      `\dots{}`,
+		'•':      `\textbullet{}`,
+		'·':      `\textperiodcentered{}`,
+		'†':      `\dag{}`,
+		'‡':      `\ddag{}`,
+		'§':      `\S{}`,
+		'¶':      `\P{}`,
+		// symbols
+		'€': `\texteuro{}`,
+		'£': `\pounds{}`,
+		'¥': `\textyen{}`,
+		'¢': `\textcent{}`,
+		'¤': `\textcurrency{}`,
+		'°': `\textdegree{}`,
+		'©': `\textcopyright{}`,
+		'®': `\textregistered{}`,
+		'™': `\texttrademark{}`,
+		'µ': `\textmu{}`,
+		'×': `\texttimes{}`,
+		'÷': `\textdiv{}`,
+		'±': `\textpm{}`,
+		'¬': `\textlnot{}`,
+		'¦': `\textbrokenbar{}`,
+		'‰': `\textperthousand{}`,
+		'½': `\textonehalf{}`,
+		'¼': `\textonequarter{}`,
+		'¾': `\textthreequarters{}`,
+		'¹': `\textonesuperior{}`,
+		'²': `\texttwosuperior{}`,
+		'³': `\textthreesuperior{}`,
+		'ª': `\textordfeminine{}`,
+		'º': `\textordmasculine{}`,
+		'→': `\textrightarrow{}`,
+		'←': `\textleftarrow{}`,
+		'↑': `\textuparrow{}`,
+		'↓': `\textdownarrow{}`,
+	}
+
+	// accentCommands maps combining characters to LaTeX accent commands.
+	accentCommands = map[rune]string{
+		'\u0300': "\\`",
+		'\u0301': `\'`,
+		'\u0302': `\^`,
+		'\u0303': `\~`,
+		'\u0304': `\=`,
+		'\u0306': `\u`,
+		'\u0307': `\.`,
+		'\u0308': `\"`,
+		'\u030a': `\r`,
+		'\u030b': `\H`,
+		'\u030c': `\v`,
+		'\u0323': `\d`,
+		'\u0327': `\c`,
+		'\u0328': `\k`,
+		'\u0331': `\b`,
+	}
+)
+
+// Transliterator converts non-ASCII runes into LaTeX commands, for example "ř"
+// becomes \v{r} and "€" becomes \texteuro{}. This is useful for LaTeX engines
+// without full UTF-8 support.
+//
+// Letters with accents are converted by decomposing them, all other runes are
+// looked up in Symbols. Runes that can't be converted are handled as described
+// by Fallback. If Math is true each converted rune is wrapped in \mbox{...} so
+// that the text mode commands can be used in math mode.
+type Transliterator struct {
+	Symbols  map[rune]string
+	Fallback UnicodeFallback
+	Math     bool
+}
+
+// NewTransliterator returns a new Transliterator that uses UnicodeSymbols.
+func NewTransliterator(fallback UnicodeFallback) *Transliterator {
+	return &Transliterator{
+		Symbols:  UnicodeSymbols,
+		Fallback: fallback,
+	}
+}
+
+// accented returns the LaTeX code for a letter with accents, for example
+// \v{r}. The second return value is false if r is not of this form.
+func accented(r rune) (string, bool) {
+	decomposed := norm.NFD.String(string(r))
+	base, size := utf8.DecodeRuneInString(decomposed)
+	if size == len(decomposed) || base >= utf8.RuneSelf || !isASCIILetter(byte(base)) {
+		return "", false
+	}
+	res := string(base)
+	// dotless i and j are required for accents on i and j
+	switch base {
+	case 'i':
+		res = `\i`
+	case 'j':
+		res = `\j`
+	}
+	for _, mark := range decomposed[size:] {
+		cmd, has := accentCommands[mark]
+		if !has {
+			return "", false
+		}
+		res = cmd + "{" + res + "}"
+	}
+	return res, true
+}
+
+// Transliterate converts all non-ASCII runes in s. It returns an error of type
+// UnicodeError if a rune can't be converted and the fallback is
+// FallbackError.
+func (t *Transliterator) Transliterate(s string) (string, error) {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			b.WriteRune(r)
+			continue
+		}
+		latex, has := t.Symbols[r]
+		if !has {
+			latex, has = accented(r)
+		}
+		if has {
+			if t.Math {
+				latex = `\mbox{` + latex + "}"
+			}
+			b.WriteString(latex)
+			continue
+		}
+		switch t.Fallback {
+		case FallbackDrop:
+		case FallbackQuestionMark:
+			b.WriteByte('?')
+		default:
+			return "", UnicodeError{r}
+		}
+	}
+	return b.String(), nil
+}
+
+// EscapeFunc returns a LatexEscapeFunc that first applies replace (if not nil)
+// and then transliterates the result. For example
+// t.EscapeFunc(EscapeWithDefaults(nil)) escapes special characters and
+// converts non-ASCII runes.
+//
+// A LatexEscapeFunc can't return an error, so if the fallback is FallbackError
+// the returned function panics with a UnicodeError. Panics in template
+// functions are reported as errors by the template package, outside of
+// templates use EscapeErr to get the error.
+func (t *Transliterator) EscapeFunc(replace LatexEscapeFunc) LatexEscapeFunc {
+	return func(s string) string {
+		if replace != nil {
+			s = replace(s)
+		}
+		res, err := t.Transliterate(s)
+		if err != nil {
+			panic(err)
+		}
+		return res
+	}
+}
+
+// EscapeErr applies replace (if not nil) to s. If replace panics with a
+// UnicodeError (see Transliterator.EscapeFunc) the error is returned, all
+// other panics are not recovered.
+func EscapeErr(replace LatexEscapeFunc, s string) (res string, err error) {
+	if replace == nil {
+		return s, nil
+	}
+	defer recoverUnicodeError(&err)
+	return replace(s), nil
+}
+
+// recoverUnicodeError must be deferred, it stores a UnicodeError panic in err.
+// All other panics are not recovered.
+func recoverUnicodeError(err *error) {
+	if r := recover(); r != nil {
+		unicodeErr, ok := r.(UnicodeError)
+		if !ok {
+			panic(r)
+		}
+		*err = unicodeErr
+	}
+}
+
+// TransliterateWithDefaults returns an escape function that escapes with
+// EscapeWithDefaults(additional) and then transliterates non-ASCII runes with
+// the given fallback.
+func TransliterateWithDefaults(additional []string, fallback UnicodeFallback) LatexEscapeFunc {
+	return NewTransliterator(fallback).EscapeFunc(EscapeWithDefaults(additional))
+}
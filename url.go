@@ -0,0 +1,100 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// urlReplacer escapes the characters that have a special meaning in the
+	// argument of \url and \href. Characters like _ and ~ are allowed in the
+	// argument and are not replaced. Backslashes and spaces are percent-encoded.
+	urlReplacer = strings.NewReplacer(
+		"%", `\%`,
+		"#", `\#`,
+		`\`, `\%5C`,
+		" ", `\%20`,
+	)
+)
+
+// EscapeURL escapes s such that it can be used as the argument of \url or as
+// the first argument of \href. % and # are escaped, but for example _ and ~ are
+// not changed.
+//
+// An error is returned if s contains unbalanced braces or a line break.
+func EscapeURL(s string) (string, error) {
+	if strings.ContainsAny(s, "\r\n") {
+		return "", errors.New("invalid url: Must not contain a line break")
+	}
+	depth := 0
+	for _, r := range s {
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth < 0 {
+				return "", fmt.Errorf("invalid url \"%s\": Contains unbalanced braces", s)
+			}
+		}
+	}
+	if depth != 0 {
+		return "", fmt.Errorf("invalid url \"%s\": Contains unbalanced braces", s)
+	}
+	return urlReplacer.Replace(strings.TrimSpace(s)), nil
+}
+
+// URL returns \url{...} with the concatenation of args escaped by EscapeURL.
+func URL(args ...interface{}) (string, error) {
+	asStrings := make([]string, len(args))
+	for i, arg := range args {
+		asStrings[i] = plainString(arg)
+	}
+	escaped, err := EscapeURL(strings.Join(asStrings, " "))
+	if err != nil {
+		return "", err
+	}
+	return `\url{` + escaped + `}`, nil
+}
+
+// Href returns a function that creates a \href{url}{text} command. The url is
+// escaped with EscapeURL and the text (concatenation of args) is escaped with
+// replace (if not nil). If no args are given the url is used as text.
+func Href(replace LatexEscapeFunc) func(url interface{}, args ...interface{}) (string, error) {
+	return func(url interface{}, args ...interface{}) (string, error) {
+		escaped, err := EscapeURL(plainString(url))
+		if err != nil {
+			return "", err
+		}
+		if len(args) == 0 {
+			args = []interface{}{url}
+		}
+		text := LatexEscaper(replace)(args...)
+		return `\href{` + escaped + `}{` + text + `}`, nil
+	}
+}
+
+// URLModifier escapes value with EscapeURL, it should be used inside \url{}
+// or the first argument of \href{}{}. If replace is nil the value is not
+// changed.
+func URLModifier(value string, replace LatexEscapeFunc) (string, error) {
+	if replace == nil {
+		return value, nil
+	}
+	return EscapeURL(value)
+}
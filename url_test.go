@@ -0,0 +1,110 @@
+// Copyright 2018 - 2020 Fabian Wenzelmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gummibaum
+
+import "testing"
+
+func TestEscapeURL(t *testing.T) {
+	tests := []struct {
+		url, expected string
+	}{
+		{"http://x.org/a_b~c", `http://x.org/a_b~c`},
+		{"http://x.org/a%20b#top", `http://x.org/a\%20b\#top`},
+		{`http://x.org/a\b c`, `http://x.org/a\%5Cb\%20c`},
+		{"  http://x.org/{a}  ", `http://x.org/{a}`},
+		{"", ""},
+	}
+	for _, test := range tests {
+		got, err := EscapeURL(test.url)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.url, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.url, test.expected, got)
+		}
+	}
+	for _, url := range []string{"http://x.org/}", "http://x.org/{a", "}{", "http://x.org/\nb", "a\rb"} {
+		if got, err := EscapeURL(url); err == nil {
+			t.Errorf("%q: expected an error, got %q", url, got)
+		}
+	}
+}
+
+func TestURLFuncs(t *testing.T) {
+	data := map[string]string{"U": "http://x.org/a_b?c=1&d=50%#e", "T": "A & B"}
+	tests := []struct {
+		name, template, expected string
+	}{
+		{"url", `#(url .U#)`, `\url{http://x.org/a_b?c=1&d=50\%\#e}`},
+		{"url concatenation", `#(url "http://x.org/" "a"#)`, `\url{http://x.org/\%20a}`},
+		{"href", `#(href .U .T#)`, `\href{http://x.org/a_b?c=1&d=50\%\#e}{A \& B}`},
+		{"href without text", `#(href "http://x.org/a_b"#)`, `\href{http://x.org/a_b}{http://x.org/a\_b}`},
+		{"href text arguments", `#(href "http://x.org" "a" "b"#)`, `\href{http://x.org}{a b}`},
+		{"href upper", `#(href "http://x.org" (upper "a_b")#)`, `\href{http://x.org}{A\_B}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, opts := range []*TemplateOptions{{Replace: EscapeWithDefaults(nil)}, autoEscapeOptions()} {
+				got, err := executeTemplate(opts, data, test.template)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got != test.expected {
+					t.Errorf("auto escape %v: expected %q, got %q", opts.AutoEscape, test.expected, got)
+				}
+			}
+		})
+	}
+	for _, template := range []string{`#(url "http://x.org/{"#)`, `#(href "a}" "b"#)`, `#(href#)`} {
+		if got, err := executeTemplate(autoEscapeOptions(), data, template); err == nil {
+			t.Errorf("%s: expected an error, got %q", template, got)
+		}
+	}
+}
+
+func TestURLModifier(t *testing.T) {
+	opts := &ExpandOptions{Replace: EscapeWithDefaults(nil), Modifiers: DefaultExpandModifiers()}
+	handler, err := NewConstHandlerWithOptions(map[string]string{
+		"LINK": "http://x.org/a_b#c",
+		"BAD":  "http://x.org/}",
+	}, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		line, expected string
+	}{
+		{`\url{LINK|url}`, `\url{http://x.org/a_b\#c}`},
+		{`\href{LINK|url}{LINK}`, `\href{http://x.org/a_b\#c}{http://x.org/a\_b\#c}`},
+		{`BAD`, `http://x.org/\}`},
+	}
+	for _, test := range tests {
+		got, err := handler.HandleLineErr(test.line)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.line, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.line, test.expected, got)
+		}
+	}
+	if got, err := handler.HandleLineErr(`\url{BAD|url}`); err == nil {
+		t.Errorf("expected an error, got %q", got)
+	}
+	if got, err := URLModifier("a b", nil); err != nil || got != "a b" {
+		t.Errorf("nil replace: expected the value, got %q, %v", got, err)
+	}
+}